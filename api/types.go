@@ -1,6 +1,9 @@
 package api
 
-import "context"
+import (
+	"context"
+	"fmt"
+)
 
 // Module a plugin that can be initialized
 type Module interface {
@@ -21,3 +24,17 @@ type Commands interface {
 	Module
 	Registry() map[string]Command
 }
+
+// ExitStatus is returned by a command to fail with a specific exit status,
+// the shell does not print it as an error message
+type ExitStatus int
+
+func (e ExitStatus) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e ExitStatus) ExitCode() int { return int(e) }
+
+// ExitShell is returned by a command to end the shell session, the shell
+// exits with the given status
+type ExitShell int
+
+func (e ExitShell) Error() string { return fmt.Sprintf("exit %d", int(e)) }
+func (e ExitShell) ExitCode() int { return int(e) }
@@ -2,6 +2,7 @@ package api
 
 import (
 	"context"
+	"errors"
 	"io"
 	"log"
 	"os"
@@ -25,6 +26,56 @@ func GetStdout(ctx context.Context) io.Writer {
 	return out
 }
 
+func GetStderr(ctx context.Context) io.Writer {
+	var out io.Writer = os.Stderr
+	if ctx == nil {
+		return out
+	}
+	if outVal := ctx.Value("gosh.stderr"); outVal != nil {
+		if stderr, ok := outVal.(io.Writer); ok {
+			out = stderr
+		}
+	}
+	return out
+}
+
+func GetStdin(ctx context.Context) io.Reader {
+	var in io.Reader = os.Stdin
+	if ctx == nil {
+		return in
+	}
+	if inVal := ctx.Value("gosh.stdin"); inVal != nil {
+		if stdin, ok := inVal.(io.Reader); ok {
+			in = stdin
+		}
+	}
+	return in
+}
+
+// GetStatus returns the exit status of the last command run by the shell
+func GetStatus(ctx context.Context) int {
+	if ctx == nil {
+		return 0
+	}
+	if status, ok := ctx.Value("gosh.status").(int); ok {
+		return status
+	}
+	return 0
+}
+
+// Status returns the exit status matching the error returned by a command:
+// 0 for nil, the code of errors with an ExitCode method and 1 otherwise
+func Status(err error) int {
+	if err == nil {
+		return 0
+	}
+	var coded interface{ ExitCode() int }
+	if errors.As(err, &coded) {
+		return coded.ExitCode()
+	}
+	return 1
+}
+
 func GetPrompt(ctx context.Context) string {
 	prompt := DefaultPrompt
 	if ctx == nil {
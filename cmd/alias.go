@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// expandAlias replaces the alias at the current position with its value,
+// it reports whether there was one
+func (p *parser) expandAlias() bool {
+	if len(p.aliases) == 0 {
+		return false
+	}
+	end := p.pos
+	for end < len(p.src) && !isMeta(p.src[end]) {
+		end++
+	}
+	name := string(p.src[p.pos:end])
+	value, ok := p.aliases[name]
+	if !ok || p.pos < p.aliasEnd[name] {
+		return false
+	}
+
+	text := []rune(value)
+	src := make([]rune, 0, len(p.src)-len(name)+len(text))
+	src = append(src, p.src[:p.pos]...)
+	src = append(src, text...)
+	p.src = append(src, p.src[end:]...)
+
+	// the text of the aliases being expanded moved with the replacement
+	if p.aliasEnd == nil {
+		p.aliasEnd = make(map[string]int)
+	}
+	for n, e := range p.aliasEnd {
+		if e > p.pos {
+			p.aliasEnd[n] = e + len(text) - (end - p.pos)
+		}
+	}
+	p.aliasEnd[name] = p.pos + len(text)
+	return true
+}
+
+// isAliasName reports whether name can be used for an alias
+func isAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t\n;&|<>()'\"\\$`=/")
+}
+
+// aliasCmd defines aliases, which replace a command name with a text
+type aliasCmd string
+
+func (c aliasCmd) Name() string     { return string(c) }
+func (c aliasCmd) Usage() string    { return "alias [name[=value] ...]" }
+func (c aliasCmd) LongDesc() string { return "" }
+func (c aliasCmd) ShortDesc() string {
+	return `defines or prints aliases, a command named after an alias is replaced with its value`
+}
+func (c aliasCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	out := api.GetStdout(ctx)
+	if len(args) < 2 {
+		names := make([]string, 0, len(gosh.aliases))
+		for name := range gosh.aliases {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "alias %s=%s\n", name, shellQuote(gosh.aliases[name]))
+		}
+		return ctx, nil
+	}
+
+	var result error
+	for _, arg := range args[1:] {
+		name, value, hasValue := strings.Cut(arg, "=")
+		switch {
+		case !isAliasName(name):
+			result = statusError{status: 1, msg: fmt.Sprintf("%s: `%s': invalid alias name", c.Name(), name)}
+		case hasValue:
+			gosh.aliases[name] = value
+		default:
+			value, ok := gosh.aliases[name]
+			if !ok {
+				result = statusError{status: 1, msg: fmt.Sprintf("%s: %s: not found", c.Name(), name)}
+				continue
+			}
+			fmt.Fprintf(out, "alias %s=%s\n", name, shellQuote(value))
+		}
+	}
+	return ctx, result
+}
+
+// unaliasCmd removes aliases
+type unaliasCmd string
+
+func (c unaliasCmd) Name() string     { return string(c) }
+func (c unaliasCmd) Usage() string    { return "unalias [-a] name ..." }
+func (c unaliasCmd) LongDesc() string { return "" }
+func (c unaliasCmd) ShortDesc() string {
+	return `removes aliases, -a removes all of them`
+}
+func (c unaliasCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	var result error
+	for _, name := range args[1:] {
+		if name == "-a" {
+			clear(gosh.aliases)
+			continue
+		}
+		if _, ok := gosh.aliases[name]; !ok {
+			result = statusError{status: 1, msg: fmt.Sprintf("%s: %s: not found", c.Name(), name)}
+			continue
+		}
+		delete(gosh.aliases, name)
+	}
+	return ctx, result
+}
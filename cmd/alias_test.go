@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShellAliases(t *testing.T) {
+	tests := []scriptTest{
+		{"alias say='args said'\nsay hi", "[said][hi]\n", 0},
+		{"alias say='args said'; say hi", "command not found: say\n", 127},
+		{"alias up=upper\nargs x | up", "[X]\n", 0},
+		{"alias args='args wrapped'\nargs x", "[wrapped][x]\n", 0},
+		{"alias a=b b='a x' \nb", "command not found: b\n", 127},
+		{"alias two='args 1; args 2'\ntwo", "[1]\n[2]\n", 0},
+		{"alias say='args said'\n\\say", "command not found: say\n", 127},
+		{"alias say='args said'\nargs say", "[say]\n", 0},
+		{"alias say='args said'\nalias say; alias", "alias say='args said'\nalias say='args said'\n", 0},
+		{"alias say='args said'\nunalias say\nsay", "command not found: say\n", 127},
+		{"alias nope", "alias: nope: not found\n", 1},
+		{"unalias nope", "unalias: nope: not found\n", 1},
+	}
+	runScripts(t, tests, nil)
+}
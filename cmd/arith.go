@@ -0,0 +1,538 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// arithPart is an arithmetic expansion $((expr)), replaced by the value of
+// expr once its parameters and command substitutions are expanded
+type arithPart struct {
+	expr   word
+	quoted bool
+}
+
+// arithCmd is an arithmetic command ((expr)), it succeeds when expr is not
+// zero
+type arithCmd struct {
+	expr word
+}
+
+// arithExpr parses the expression of $((expr)) or ((expr)) following the
+// opening parentheses, up to the closing ones
+func (p *parser) arithExpr() (word, error) {
+	start := p.pos
+	depth := 0
+	for {
+		if p.eof() {
+			return nil, incomplete("unterminated ((")
+		}
+		switch p.peek() {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				if p.peekAt(1) != ')' {
+					return nil, p.unexpected()
+				}
+				src := p.src[start:p.pos]
+				p.pos += 2
+				sub := &parser{src: src}
+				return sub.wordUntil(func(rune) bool { return false })
+			}
+			depth--
+		}
+		p.pos++
+	}
+}
+
+// arithCommand parses ((expr))
+func (p *parser) arithCommand() (node, error) {
+	p.pos += 2 // ((
+	expr, err := p.arithExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &arithCmd{expr: expr}, nil
+}
+
+// expandArith returns the value of an arithmetic expression
+func (gosh *Goshell) expandArith(ctx context.Context, expr word) (int64, error) {
+	s, err := gosh.expandString(ctx, expr)
+	if err != nil {
+		return 0, err
+	}
+	return gosh.arith(s)
+}
+
+// execArith runs an arithmetic command
+func (gosh *Goshell) execArith(ctx context.Context, ac *arithCmd) (context.Context, error) {
+	value, err := gosh.expandArith(ctx, ac.expr)
+	if err != nil {
+		return ctx, statusError{status: 1, msg: err.Error()}
+	}
+	if value == 0 {
+		return ctx, api.ExitStatus(1)
+	}
+	return ctx, nil
+}
+
+// arithLevels are the binary operators from the lowest to the highest
+// precedence, ** binds tighter and is right associative
+var arithLevels = [][]string{
+	{"||"}, {"&&"}, {"|"}, {"^"}, {"&"}, {"==", "!="},
+	{"<", "<=", ">", ">="}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"},
+}
+
+// arithOps are the operator tokens, longest first
+var arithOps = []string{
+	"<<=", ">>=", "**", "++", "--", "<<", ">>", "<=", ">=", "==", "!=", "&&", "||",
+	"+=", "-=", "*=", "/=", "%=", "&=", "^=", "|=",
+	"+", "-", "*", "/", "%", "<", ">", "&", "|", "^", "!", "~", "?", ":", "=", "(", ")", ",",
+}
+
+// maxArithDepth bounds the evaluation of variables holding expressions
+const maxArithDepth = 64
+
+// arithEval evaluates an arithmetic expression. Variables are read and
+// assigned in the shell, an unset or empty variable is 0 and a variable
+// holding an expression is evaluated. skip is set while evaluating the
+// operand that &&, || or ?: do not need, which has no side effects.
+type arithEval struct {
+	gosh  *Goshell
+	expr  string
+	pos   int
+	tok   string
+	skip  int
+	depth int
+}
+
+// arith evaluates an arithmetic expression
+func (gosh *Goshell) arith(expr string) (int64, error) {
+	return (&arithEval{gosh: gosh}).eval(expr)
+}
+
+func (e *arithEval) eval(expr string) (int64, error) {
+	if e.depth > maxArithDepth {
+		return 0, fmt.Errorf("%s: expression recursion level exceeded", expr)
+	}
+	saved := *e
+	defer func() { e.expr, e.pos, e.tok = saved.expr, saved.pos, saved.tok }()
+	e.expr, e.pos = expr, 0
+	if strings.TrimSpace(expr) == "" {
+		return 0, nil
+	}
+	if err := e.next(); err != nil {
+		return 0, err
+	}
+	value, err := e.comma()
+	if err != nil {
+		return 0, err
+	}
+	if e.tok != "" {
+		return 0, e.syntaxError()
+	}
+	return value, nil
+}
+
+func (e *arithEval) syntaxError() error {
+	rest := strings.TrimSpace(e.expr[e.pos-len(e.tok):])
+	if rest == "" {
+		return fmt.Errorf("%s: syntax error: operand expected", e.expr)
+	}
+	return fmt.Errorf("%s: syntax error in expression (error token is \"%s\")", e.expr, rest)
+}
+
+// next reads the next token, which is "" at the end of the expression
+func (e *arithEval) next() error {
+	for e.pos < len(e.expr) && strings.ContainsRune(" \t\n", rune(e.expr[e.pos])) {
+		e.pos++
+	}
+	if e.pos >= len(e.expr) {
+		e.tok = ""
+		return nil
+	}
+	start := e.pos
+	if c := e.expr[e.pos]; isNameChar(rune(c)) {
+		for e.pos < len(e.expr) && (isNameChar(rune(e.expr[e.pos])) || e.expr[e.pos] == '#') {
+			e.pos++
+		}
+		e.tok = e.expr[start:e.pos]
+		return nil
+	}
+	for _, op := range arithOps {
+		if strings.HasPrefix(e.expr[e.pos:], op) {
+			e.pos += len(op)
+			e.tok = op
+			return nil
+		}
+	}
+	e.pos++
+	e.tok = e.expr[start:e.pos]
+	return e.syntaxError()
+}
+
+// peek returns the token following the current one
+func (e *arithEval) peek() string {
+	pos, tok := e.pos, e.tok
+	defer func() { e.pos, e.tok = pos, tok }()
+	if e.next() != nil {
+		return ""
+	}
+	return e.tok
+}
+
+func (e *arithEval) comma() (int64, error) {
+	value, err := e.assign()
+	for err == nil && e.tok == "," {
+		if err = e.next(); err == nil {
+			value, err = e.assign()
+		}
+	}
+	return value, err
+}
+
+// arithAssignOps are the assignment operators
+var arithAssignOps = []string{"=", "+=", "-=", "*=", "/=", "%=", "<<=", ">>=", "&=", "^=", "|="}
+
+func (e *arithEval) assign() (int64, error) {
+	name, op := e.tok, e.peek()
+	if !isName(name) || !slices.Contains(arithAssignOps, op) {
+		return e.ternary()
+	}
+	e.next() // the name, already read
+	if err := e.next(); err != nil {
+		return 0, err
+	}
+	value, err := e.assign()
+	if err != nil {
+		return 0, err
+	}
+	if op != "=" {
+		current, err := e.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		if value, err = e.binary(strings.TrimSuffix(op, "="), current, value); err != nil {
+			return 0, err
+		}
+	}
+	e.set(name, value)
+	return value, nil
+}
+
+func (e *arithEval) ternary() (int64, error) {
+	cond, err := e.binaryLevel(0)
+	if err != nil || e.tok != "?" {
+		return cond, err
+	}
+	if err := e.next(); err != nil {
+		return 0, err
+	}
+	if cond == 0 {
+		e.skip++
+	}
+	then, err := e.assign()
+	if cond == 0 {
+		e.skip--
+	}
+	if err != nil {
+		return 0, err
+	}
+	if e.tok != ":" {
+		return 0, e.syntaxError()
+	}
+	if err := e.next(); err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		e.skip++
+	}
+	otherwise, err := e.ternary()
+	if cond != 0 {
+		e.skip--
+		return then, err
+	}
+	return otherwise, err
+}
+
+// binaryLevel evaluates the operators of arithLevels from level up
+func (e *arithEval) binaryLevel(level int) (int64, error) {
+	if level == len(arithLevels) {
+		return e.power()
+	}
+	left, err := e.binaryLevel(level + 1)
+	if err != nil {
+		return 0, err
+	}
+	for slices.Contains(arithLevels[level], e.tok) {
+		op := e.tok
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		// the right side of && and || is only evaluated when needed
+		shortCut := (op == "&&" && left == 0) || (op == "||" && left != 0)
+		if shortCut {
+			e.skip++
+		}
+		right, err := e.binaryLevel(level + 1)
+		if shortCut {
+			e.skip--
+		}
+		if err != nil {
+			return 0, err
+		}
+		if left, err = e.binary(op, left, right); err != nil {
+			return 0, err
+		}
+	}
+	return left, nil
+}
+
+func (e *arithEval) power() (int64, error) {
+	base, err := e.unary()
+	if err != nil || e.tok != "**" {
+		return base, err
+	}
+	if err := e.next(); err != nil {
+		return 0, err
+	}
+	exp, err := e.power()
+	if err != nil {
+		return 0, err
+	}
+	return e.binary("**", base, exp)
+}
+
+func (e *arithEval) unary() (int64, error) {
+	switch op := e.tok; op {
+	case "+", "-", "!", "~":
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		value, err := e.unary()
+		switch op {
+		case "-":
+			value = -value
+		case "!":
+			value = boolInt(value == 0)
+		case "~":
+			value = ^value
+		}
+		return value, err
+	case "++", "--":
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		name := e.tok
+		if !isName(name) {
+			return 0, e.syntaxError()
+		}
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		value, err := e.variable(name)
+		if err != nil {
+			return 0, err
+		}
+		value += increment(op)
+		e.set(name, value)
+		return value, nil
+	}
+	return e.primary()
+}
+
+func (e *arithEval) primary() (int64, error) {
+	tok := e.tok
+	switch {
+	case tok == "(":
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		value, err := e.comma()
+		if err != nil {
+			return 0, err
+		}
+		if e.tok != ")" {
+			return 0, e.syntaxError()
+		}
+		return value, e.next()
+	case isName(tok):
+		if err := e.next(); err != nil {
+			return 0, err
+		}
+		value, err := e.variable(tok)
+		if err != nil {
+			return 0, err
+		}
+		if e.tok == "++" || e.tok == "--" {
+			e.set(tok, value+increment(e.tok))
+			return value, e.next()
+		}
+		return value, nil
+	case tok != "" && tok[0] >= '0' && tok[0] <= '9':
+		value, err := parseArithNumber(tok)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", e.expr, err)
+		}
+		return value, e.next()
+	}
+	return 0, e.syntaxError()
+}
+
+// variable returns the value of a variable in an expression
+func (e *arithEval) variable(name string) (int64, error) {
+	s, _ := e.gosh.getVar(name)
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	if value, err := parseArithNumber(s); err == nil {
+		return value, nil
+	}
+	e.depth++
+	defer func() { e.depth-- }()
+	return e.eval(s)
+}
+
+func (e *arithEval) set(name string, value int64) {
+	if e.skip == 0 {
+		e.gosh.setVar(name, strconv.FormatInt(value, 10))
+	}
+}
+
+// binary applies a binary operator
+func (e *arithEval) binary(op string, x, y int64) (int64, error) {
+	switch op {
+	case "||":
+		return boolInt(x != 0 || y != 0), nil
+	case "&&":
+		return boolInt(x != 0 && y != 0), nil
+	case "|":
+		return x | y, nil
+	case "^":
+		return x ^ y, nil
+	case "&":
+		return x & y, nil
+	case "==":
+		return boolInt(x == y), nil
+	case "!=":
+		return boolInt(x != y), nil
+	case "<":
+		return boolInt(x < y), nil
+	case "<=":
+		return boolInt(x <= y), nil
+	case ">":
+		return boolInt(x > y), nil
+	case ">=":
+		return boolInt(x >= y), nil
+	case "<<":
+		return x << uint64(y&63), nil
+	case ">>":
+		return x >> uint64(y&63), nil
+	case "+":
+		return x + y, nil
+	case "-":
+		return x - y, nil
+	case "*":
+		return x * y, nil
+	case "/", "%":
+		if y == 0 {
+			if e.skip > 0 {
+				return 0, nil
+			}
+			return 0, fmt.Errorf("%s: division by 0", e.expr)
+		}
+		if op == "/" {
+			return x / y, nil
+		}
+		return x % y, nil
+	case "**":
+		if y < 0 {
+			return 0, fmt.Errorf("%s: exponent less than 0", e.expr)
+		}
+		result := int64(1)
+		for ; y > 0; y-- {
+			result *= x
+		}
+		return result, nil
+	}
+	return 0, fmt.Errorf("%s: unknown operator %s", e.expr, op)
+}
+
+// parseArithNumber parses a decimal, octal (0755), hexadecimal (0xff) or
+// base#digits integer constant
+func parseArithNumber(s string) (int64, error) {
+	if base, digits, ok := strings.Cut(s, "#"); ok {
+		b, err := strconv.Atoi(base)
+		if err != nil || b < 2 || b > 36 {
+			return 0, fmt.Errorf("%s: invalid arithmetic base", s)
+		}
+		value, err := strconv.ParseInt(digits, b, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: value too great for base", s)
+		}
+		return value, nil
+	}
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	case len(s) > 1 && s[0] == '0':
+		base = 8
+	}
+	value, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: value too great for base", s)
+	}
+	return value, nil
+}
+
+// increment returns the change made by ++ or --
+func increment(op string) int64 {
+	if op == "--" {
+		return -1
+	}
+	return 1
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// letCmd evaluates arithmetic expressions
+type letCmd string
+
+func (c letCmd) Name() string     { return string(c) }
+func (c letCmd) Usage() string    { return "let expr ..." }
+func (c letCmd) LongDesc() string { return "" }
+func (c letCmd) ShortDesc() string {
+	return `evaluates arithmetic expressions, fails if the last one is 0`
+}
+func (c letCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(args) < 2 {
+		return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: expression expected", c.Name())}
+	}
+	var value int64
+	for _, expr := range args[1:] {
+		if value, err = gosh.arith(expr); err != nil {
+			return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+		}
+	}
+	if value == 0 {
+		return ctx, api.ExitStatus(1)
+	}
+	return ctx, nil
+}
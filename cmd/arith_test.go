@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShellArithmetic(t *testing.T) {
+	tests := []scriptTest{
+		{"args $((1 + 2 * 3)) $(( (1 + 2) * 3 )) $((2 ** 10))", "[7][9][1024]\n", 0},
+		{"args $((7 / 2)) $((7 % 3)) $((-7 / 2)) $((-3 - -2))", "[3][1][-3][-1]\n", 0},
+		{"args $((1 < 2)) $((3 >= 4)) $((2 == 2)) $((2 != 2)) $((!0))", "[1][0][1][0][1]\n", 0},
+		{"args $((5 & 3)) $((5 | 3)) $((5 ^ 3)) $((~0)) $((1 << 4)) $((-16 >> 2))", "[1][7][6][-1][16][-4]\n", 0},
+		{"args $((0x1f)) $((010)) $((2#101)) $((16#ff))", "[31][8][5][255]\n", 0},
+		{"X=5; args $((X + 1)) $(($X * 2)) $((X > 4 ? 10 : 20)) $((Y))", "[6][10][10][0]\n", 0},
+		{"X=5; args $((X *= 2)) $X $((Y = 3, Y + 1)) $Y", "[10][10][4][3]\n", 0},
+		{"E='1 + 2'; args $((E * 2))", "[6]\n", 0},
+		{"i=1; args $((i++)) $i $((++i)) $((i--)) $((--i)) $i", "[1][2][3][3][1][1]\n", 0},
+		{"n=0; args $((0 && n++)) $((1 || n++)) $((1 ? 2 : n++)) $n", "[0][1][2][0]\n", 0},
+		{"size=4096; args $((size / 1024))K", "[4K]\n", 0},
+		{"let 'A = 4' 'B = A * 2'; args $A $B $?", "[4][8][0]\n", 0},
+		{"let 0; args $?", "[1]\n", 0},
+		{"((1 + 1)); args $?; ((0)); args $?", "[0]\n[1]\n", 0},
+		{"i=0; while ((i < 3)); do args $i; ((i++)); done", "[0]\n[1]\n[2]\n", 0},
+		{"for x in a b; do ((n += 2)); done; args $n", "[4]\n", 0},
+		{"args $((1 / 0))", "1 / 0: division by 0\n", 1},
+		{"args $((2 ** -1))", "2 ** -1: exponent less than 0\n", 1},
+		{"args $((1 +))", "1 +: syntax error: operand expected\n", 1},
+		{"let", "let: expression expected\n", 2},
+	}
+	runScripts(t, tests, nil)
+
+	for _, line := range []string{"args $((1 +\n", "((i++\n"} {
+		if _, err := parse(line); !errors.Is(err, errIncomplete) {
+			t.Errorf("%q: got %v, want an incomplete input error", line, err)
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// arrayElem is an element of an array assignment NAME=(value [key]=value),
+// key is nil for the elements without a subscript
+type arrayElem struct {
+	key   word
+	value word
+}
+
+// subscript parses the subscript of NAME[index] following the [
+func (p *parser) subscript() (word, error) {
+	index, err := p.wordUntil(func(r rune) bool { return r == ']' })
+	if err != nil {
+		return nil, err
+	}
+	if p.eof() {
+		return nil, incomplete("unterminated [")
+	}
+	p.pos++ // ]
+	return append(word{}, index...), nil
+}
+
+// arrayLiteral parses the (value [key]=value ...) elements of an array
+// assignment, they can span several lines
+func (p *parser) arrayLiteral() ([]arrayElem, error) {
+	p.pos++ // (
+	var elems []arrayElem
+	for {
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+		if p.eof() {
+			return nil, incomplete("unterminated array")
+		}
+		if p.peek() == ')' {
+			p.pos++
+			return elems, nil
+		}
+
+		var elem arrayElem
+		if start := p.pos; p.peek() == '[' {
+			p.pos++
+			if key, err := p.subscript(); err == nil && p.peek() == '=' {
+				p.pos++
+				elem.key = key
+			} else {
+				p.pos = start
+			}
+		}
+		value, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if value == nil && elem.key == nil {
+			return nil, p.unexpected()
+		}
+		elem.value = value
+		elems = append(elems, elem)
+	}
+}
+
+// assign performs an assignment, changing the variables of the session
+func (gosh *Goshell) assign(ctx context.Context, as assign) error {
+	switch {
+	case as.array:
+		return gosh.assignArray(ctx, as.name, as.elems, as.add)
+	case as.index != nil:
+		key, err := gosh.subscriptKey(ctx, as.name, as.index)
+		if err != nil {
+			return err
+		}
+		value, err := gosh.expandString(ctx, gosh.expandTilde(as.value, true))
+		if err != nil {
+			return err
+		}
+		if as.add {
+			old, _ := gosh.getElem(as.name, key)
+			value = old + value
+		}
+		gosh.setElem(as.name, key, value)
+		return nil
+	}
+	value, err := gosh.assignValue(ctx, as)
+	if err != nil {
+		return err
+	}
+	gosh.setVar(as.name, value)
+	return nil
+}
+
+// assignValue returns the value a NAME=value or NAME+=value assignment gives
+// to a variable
+func (gosh *Goshell) assignValue(ctx context.Context, as assign) (string, error) {
+	value, err := gosh.expandString(ctx, gosh.expandTilde(as.value, true))
+	if err != nil {
+		return "", err
+	}
+	if as.add {
+		old, _ := gosh.getVar(as.name)
+		value = old + value
+	}
+	return value, nil
+}
+
+// assignArray replaces the elements of an array, or appends to them. The
+// values of elements without a subscript are split into fields and globbed
+// like command arguments, each field making an element.
+func (gosh *Goshell) assignArray(ctx context.Context, name string, elems []arrayElem, add bool) error {
+	old, exists := gosh.vars[name]
+	v := &variable{elems: make(map[string]string)}
+	if exists {
+		v.exported, v.assoc = old.exported, old.assoc
+		if add {
+			v = old.clone()
+			if v.elems == nil {
+				v.elems = map[string]string{"0": v.value}
+				v.value = ""
+			}
+		}
+	}
+
+	next := 0
+	if !v.assoc {
+		next = maxIndex(v) + 1
+	}
+	for _, elem := range elems {
+		if elem.key == nil {
+			if v.assoc {
+				return fmt.Errorf("%s: must use subscript when assigning associative array", name)
+			}
+			fields, err := gosh.expandWords(ctx, []word{elem.value})
+			if err != nil {
+				return err
+			}
+			for _, f := range fields {
+				v.elems[strconv.Itoa(next)] = f
+				next++
+			}
+			continue
+		}
+
+		value, err := gosh.expandString(ctx, gosh.expandTilde(elem.value, true))
+		if err != nil {
+			return err
+		}
+		key, err := gosh.expandString(ctx, elem.key)
+		if err != nil {
+			return err
+		}
+		if !v.assoc {
+			n, err := gosh.arith(key)
+			if err != nil {
+				return err
+			}
+			if n < 0 {
+				return fmt.Errorf("%s[%s]: bad array subscript", name, key)
+			}
+			key = strconv.FormatInt(n, 10)
+			next = int(n) + 1
+		}
+		v.elems[key] = value
+	}
+	gosh.vars[name] = v
+	return nil
+}
+
+// maxIndex returns the highest index of an indexed array, -1 if it has no
+// elements
+func maxIndex(v *variable) int {
+	keys := v.keys()
+	if len(keys) == 0 {
+		return -1
+	}
+	n, _ := strconv.Atoi(keys[len(keys)-1])
+	return n
+}
+
+// subscriptKey expands the subscript of NAME[index] into the key of an
+// element, the subscript of an indexed array is an arithmetic expression
+// and counts from the end of the array when negative
+func (gosh *Goshell) subscriptKey(ctx context.Context, name string, index word) (string, error) {
+	s, err := gosh.expandString(ctx, index)
+	if err != nil {
+		return "", err
+	}
+	if gosh.isAssoc(name) {
+		return s, nil
+	}
+	return gosh.indexKey(name, s)
+}
+
+// indexKey evaluates the subscript of an indexed array
+func (gosh *Goshell) indexKey(name, index string) (string, error) {
+	n, err := gosh.arith(index)
+	if err != nil {
+		return "", err
+	}
+	if n < 0 {
+		if v, ok := gosh.vars[name]; ok && v.elems != nil {
+			n += int64(maxIndex(v)) + 1
+		}
+		if n < 0 {
+			return "", fmt.Errorf("%s[%s]: bad array subscript", name, index)
+		}
+	}
+	return strconv.FormatInt(n, 10), nil
+}
+
+// declarationCmds are the commands taking NAME=(value ...) arguments,
+// which are passed to them unexpanded
+var declarationCmds = map[string]bool{"declare": true, "local": true}
+
+// splitDeclaration splits a name=value or name+=value argument of declare
+// and local
+func splitDeclaration(arg string) (name, value string, hasValue, add bool) {
+	name, value, hasValue = strings.Cut(arg, "=")
+	if hasValue && strings.HasSuffix(name, "+") {
+		name, add = strings.TrimSuffix(name, "+"), true
+	}
+	return name, value, hasValue, add
+}
+
+// setDeclared sets a variable to the value of a declare or local argument,
+// a value written (...) assigns an array
+func (gosh *Goshell) setDeclared(ctx context.Context, name, value string, add bool) error {
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		p := &parser{src: []rune(value)}
+		elems, err := p.arrayLiteral()
+		if err != nil {
+			return err
+		}
+		return gosh.assignArray(ctx, name, elems, add)
+	}
+	if add {
+		old, _ := gosh.getVar(name)
+		value = old + value
+	}
+	gosh.setVar(name, value)
+	return nil
+}
+
+// declareCmd sets variables and their attributes
+type declareCmd string
+
+func (c declareCmd) Name() string  { return string(c) }
+func (c declareCmd) Usage() string { return "declare [-aAx] [-p] [name[=value] ...]" }
+func (c declareCmd) LongDesc() string {
+	return `  -a    name is an indexed array, hosts=(a b c) also creates one
+  -A    name is an associative array, ports=([http]=80 [https]=443)
+  -x    exports name, +x removes the export
+  -p    prints the variables with their attributes
+In a function, declare creates local variables.
+`
+}
+func (c declareCmd) ShortDesc() string {
+	return `declares variables and arrays, and sets their attributes`
+}
+func (c declareCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	var kind, export string
+	printVars := false
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && (args[0][0] == '-' || args[0][0] == '+') {
+		for _, flag := range args[0][1:] {
+			switch {
+			case flag == 'a' || flag == 'A':
+				kind = string(flag)
+			case flag == 'x':
+				export = args[0][:1]
+			case flag == 'p':
+				printVars = true
+			default:
+				return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %s: invalid option\nusage: %s", c.Name(), args[0], c.Usage())}
+			}
+		}
+		args = args[1:]
+	}
+
+	if printVars || (len(args) == 0 && kind == "" && export == "") {
+		names := args
+		if len(names) == 0 {
+			for name := range gosh.vars {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+		var result error
+		for _, name := range names {
+			v, ok := gosh.vars[name]
+			if !ok {
+				result = statusError{status: 1, msg: fmt.Sprintf("%s: %s: not found", c.Name(), name)}
+				continue
+			}
+			fmt.Fprintln(api.GetStdout(ctx), declaration(name, v))
+		}
+		return ctx, result
+	}
+
+	for _, arg := range args {
+		name, value, hasValue, add := splitDeclaration(arg)
+		if !isName(name) {
+			return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: `%s': not a valid identifier", c.Name(), arg)}
+		}
+		if len(gosh.frames) > 0 {
+			gosh.localVar(name)
+		}
+		v, ok := gosh.vars[name]
+		switch {
+		case kind == "":
+		case !ok:
+			v = &variable{elems: make(map[string]string), assoc: kind == "A"}
+			gosh.vars[name] = v
+		case v.assoc != (kind == "A") && v.elems != nil:
+			return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %s: cannot convert between indexed and associative arrays", c.Name(), name)}
+		case v.elems == nil:
+			v.elems, v.assoc = map[string]string{"0": v.value}, kind == "A"
+			v.value = ""
+		}
+		if hasValue {
+			if err := gosh.setDeclared(ctx, name, value, add); err != nil {
+				return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+			}
+		}
+		if export != "" {
+			gosh.exportVar(name, export == "-")
+		}
+	}
+	return ctx, nil
+}
+
+// declaration returns the declare command recreating a variable
+func declaration(name string, v *variable) string {
+	flags := "-"
+	switch {
+	case v.assoc:
+		flags += "A"
+	case v.elems != nil:
+		flags += "a"
+	}
+	if v.exported {
+		flags += "x"
+	}
+	if flags == "-" {
+		flags = "--"
+	}
+	if v.elems == nil {
+		return fmt.Sprintf("declare %s %s=%s", flags, name, shellQuote(v.value))
+	}
+	elems := make([]string, 0, len(v.elems))
+	for _, key := range v.keys() {
+		elems = append(elems, fmt.Sprintf("[%s]=%s", shellQuote(key), shellQuote(v.elems[key])))
+	}
+	return fmt.Sprintf("declare %s %s=(%s)", flags, name, strings.Join(elems, " "))
+}
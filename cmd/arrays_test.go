@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShellArrays(t *testing.T) {
+	tests := []scriptTest{
+		{"A=(a 'b c' d); args ${A[1]} ${#A[@]} ${A[-1]} $A", "[b][c][3][d][a]\n", 0},
+		{"A=(a 'b c' d); args \"${A[@]}\"; args ${A[@]}; args \"${A[*]}\"", "[a][b c][d]\n[a][b][c][d]\n[a b c d]\n", 0},
+		{"A=(a b); for x in \"${A[@]}\"; do args $x; done", "[a]\n[b]\n", 0},
+		{"A=(\n  one # first\n  two\n); args ${#A[@]} ${!A[@]}", "[2][0][1]\n", 0},
+		{"A=(a b); A+=(c); A[5]=f; args ${!A[@]}; args \"${A[@]}\"", "[0][1][2][5]\n[a][b][c][f]\n", 0},
+		{"A=(a b c); unset 'A[1]'; args ${!A[@]} \"${A[@]}\"", "[0][2][a][c]\n", 0},
+		{"A=([2]=x y [0]=z); args ${!A[@]} ${A[@]}", "[0][2][3][z][x][y]\n", 0},
+		{"A=(x y z); i=1; args ${A[i + 1]} ${A[$i]} ${#A[0]}", "[z][y][1]\n", 0},
+		{"A=(main.go doc.md); args \"${A[@]%.*}\" ${A[@]#m}", "[main][doc][ain.go][doc.md]\n", 0},
+		{"A=(); args ${#A[@]} \"${A[@]}\"; args ${A[0]-unset}", "[0]\n[unset]\n", 0},
+		{"S=scalar; args ${S[0]} ${#S[@]}; S[1]=x; args \"${S[@]}\"", "[scalar][1]\n[scalar][x]\n", 0},
+		{"S=ab; S+=cd; args $S", "[abcd]\n", 0},
+		{"declare -A P=([http]=80 [https]=443); P[ssh]=22; for k in \"${!P[@]}\"; do args $k ${P[$k]}; done", "[http][80]\n[https][443]\n[ssh][22]\n", 0},
+		{"declare -A P; P[a b]=1; args \"${!P[@]}\" ${#P[@]} ${P[x]-none}", "[a b][1][none]\n", 0},
+		{"declare -A P=([x]=1); declare -p P; A=(a 'b c'); declare -p A", "declare -A P=([x]=1)\ndeclare -a A=([0]=a [1]='b c')\n", 0},
+		{"f() { local -a A=(1 2); declare -A M=([k]=v); args ${A[1]} ${M[k]}; }; f; args \"${A[@]}${M[k]}\"", "[2][v]\n[]\n", 0},
+		{"A=(x); { A+=(y); args ${#A[@]}; } | upper; args ${#A[@]}", "[2]\n[1]\n", 0},
+		{"declare -A P; P=(nokey)", "P: must use subscript when assigning associative array\n", 1},
+		{"A=(a); declare -A A", "declare: A: cannot convert between indexed and associative arrays\n", 1},
+		{"A=(a b); args ${A[-3]}", "A[-3]: bad array subscript\n", 1},
+		{"args ${!A}", "bad substitution\n", 2},
+	}
+	runScripts(t, tests, nil)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// braceTok is a single unquoted character of a word, or one of its quoted
+// or expansion parts which brace expansion leaves untouched
+type braceTok struct {
+	r    rune
+	part wordPart
+}
+
+func (t braceTok) is(r rune) bool {
+	return t.part == nil && t.r == r
+}
+
+// expandBraces performs brace expansion on a word, a{b,c}d becomes the
+// words abd and acd while {1..3} and {a..e..2} are sequences. Braces that
+// are quoted, or that hold neither a comma nor a valid sequence, are left
+// as they are.
+func expandBraces(w word) []word {
+	hasBrace := false
+	for _, part := range w {
+		if lit, ok := part.(litPart); ok && !lit.quoted && strings.Contains(lit.text, "{") {
+			hasBrace = true
+			break
+		}
+	}
+	if !hasBrace {
+		return []word{w}
+	}
+
+	var toks []braceTok
+	for _, part := range w {
+		if lit, ok := part.(litPart); ok && !lit.quoted {
+			for _, r := range lit.text {
+				toks = append(toks, braceTok{r: r})
+			}
+			continue
+		}
+		toks = append(toks, braceTok{part: part})
+	}
+
+	expanded := braceExpand(toks)
+	words := make([]word, 0, len(expanded))
+	for _, toks := range expanded {
+		words = append(words, braceWord(toks))
+	}
+	return words
+}
+
+func braceExpand(toks []braceTok) [][]braceTok {
+	for i := range toks {
+		if !toks[i].is('{') {
+			continue
+		}
+		depth, end := 0, -1
+		var commas []int
+	scan:
+		for k := i + 1; k < len(toks); k++ {
+			switch {
+			case toks[k].is('{'):
+				depth++
+			case toks[k].is('}'):
+				if depth == 0 {
+					end = k
+					break scan
+				}
+				depth--
+			case toks[k].is(',') && depth == 0:
+				commas = append(commas, k)
+			}
+		}
+		if end < 0 {
+			break
+		}
+
+		var alts [][]braceTok
+		if len(commas) > 0 {
+			start := i + 1
+			for _, comma := range append(commas, end) {
+				alts = append(alts, toks[start:comma])
+				start = comma + 1
+			}
+		} else if alts = braceSequence(toks[i+1 : end]); alts == nil {
+			continue
+		}
+
+		var expanded [][]braceTok
+		for _, alt := range alts {
+			next := make([]braceTok, 0, len(toks))
+			next = append(next, toks[:i]...)
+			next = append(next, alt...)
+			next = append(next, toks[end+1:]...)
+			expanded = append(expanded, braceExpand(next)...)
+		}
+		return expanded
+	}
+	return [][]braceTok{toks}
+}
+
+// braceSequence expands the body of a {x..y} or {x..y..step} sequence of
+// integers or single characters, nil is returned if body is not a sequence
+func braceSequence(body []braceTok) [][]braceTok {
+	var sb strings.Builder
+	for _, tok := range body {
+		if tok.part != nil {
+			return nil
+		}
+		sb.WriteRune(tok.r)
+	}
+	bounds := strings.Split(sb.String(), "..")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil
+	}
+
+	step := 1
+	if len(bounds) == 3 {
+		var err error
+		if step, err = strconv.Atoi(bounds[2]); err != nil {
+			return nil
+		}
+		if step < 0 {
+			step = -step
+		}
+		if step == 0 {
+			step = 1
+		}
+	}
+
+	var values []string
+	from, errFrom := strconv.Atoi(bounds[0])
+	to, errTo := strconv.Atoi(bounds[1])
+	switch {
+	case errFrom == nil && errTo == nil:
+		// a leading zero on either bound pads every value to the same width
+		width := 0
+		for _, b := range bounds[:2] {
+			digits := strings.TrimPrefix(b, "-")
+			if len(digits) > 1 && digits[0] == '0' {
+				width = max(width, len(b))
+			}
+		}
+		for _, n := range seq(from, to, step) {
+			value := strconv.Itoa(n)
+			if width > 0 {
+				digits := strings.TrimPrefix(value, "-")
+				padding := strings.Repeat("0", max(width-len(value), 0))
+				value = strings.TrimSuffix(value, digits) + padding + digits
+			}
+			values = append(values, value)
+		}
+	case len([]rune(bounds[0])) == 1 && len([]rune(bounds[1])) == 1:
+		for _, n := range seq(int([]rune(bounds[0])[0]), int([]rune(bounds[1])[0]), step) {
+			values = append(values, string(rune(n)))
+		}
+	default:
+		return nil
+	}
+
+	alts := make([][]braceTok, len(values))
+	for i, value := range values {
+		for _, r := range value {
+			alts[i] = append(alts[i], braceTok{r: r})
+		}
+	}
+	return alts
+}
+
+// seq returns the numbers from from to to, counting up or down by step
+func seq(from, to, step int) []int {
+	var nums []int
+	if from <= to {
+		for n := from; n <= to; n += step {
+			nums = append(nums, n)
+		}
+	} else {
+		for n := from; n >= to; n -= step {
+			nums = append(nums, n)
+		}
+	}
+	return nums
+}
+
+// braceWord turns tokens back into a word
+func braceWord(toks []braceTok) word {
+	var w word
+	var lit strings.Builder
+	for _, tok := range toks {
+		if tok.part == nil {
+			lit.WriteRune(tok.r)
+			continue
+		}
+		if lit.Len() > 0 {
+			w = append(w, litPart{text: lit.String()})
+			lit.Reset()
+		}
+		w = append(w, tok.part)
+	}
+	if lit.Len() > 0 {
+		w = append(w, litPart{text: lit.String()})
+	}
+	return w
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// builtinCommands returns the commands implemented by the shell itself.
+// They are registered like plugin commands, but need the session running
+// them which they get from the "gosh.shell" context value.
+func builtinCommands() map[string]api.Command {
+	return map[string]api.Command{
+		".":        sourceCmd("."),
+		"[":        testCmd("["),
+		"alias":    aliasCmd("alias"),
+		"bg":       bgCmd("bg"),
+		"break":    loopCtlCmd("break"),
+		"command":  commandCmd("command"),
+		"continue": loopCtlCmd("continue"),
+		"declare":  declareCmd("declare"),
+		"disown":   disownCmd("disown"),
+		"exit":     exitCmd("exit"),
+		"export":   exportCmd("export"),
+		"fg":       fgCmd("fg"),
+		"hash":     hashCmd("hash"),
+		"jobs":     jobsCmd("jobs"),
+		"kill":     killCmd("kill"),
+		"let":      letCmd("let"),
+		"local":    localCmd("local"),
+		"return":   returnCmd("return"),
+		"set":      setCmd("set"),
+		"shift":    shiftCmd("shift"),
+		"shopt":    shoptCmd("shopt"),
+		"source":   sourceCmd("source"),
+		"test":     testCmd("test"),
+		"timeout":  timeoutCmd("timeout"),
+		"trap":     trapCmd("trap"),
+		"type":     typeCmd("type"),
+		"unalias":  unaliasCmd("unalias"),
+		"unset":    unsetCmd("unset"),
+		"wait":     waitCmd("wait"),
+		"which":    whichCmd("which"),
+	}
+}
+
+// shellFrom returns the shell session running a builtin command
+func shellFrom(ctx context.Context) (*Goshell, error) {
+	if gosh, ok := ctx.Value("gosh.shell").(*Goshell); ok {
+		return gosh, nil
+	}
+	return nil, errors.New("not running in a gosh session")
+}
+
+// shellQuote quotes s so that the shell reads it back as a single word
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !isNameChar(r) && !strings.ContainsRune("@%+=:,./-", r)
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// exportCmd marks variables to be passed to external commands
+type exportCmd string
+
+func (c exportCmd) Name() string     { return string(c) }
+func (c exportCmd) Usage() string    { return "export [-n] [name[=value] ...]" }
+func (c exportCmd) LongDesc() string { return "" }
+func (c exportCmd) ShortDesc() string {
+	return `exports variables to the environment of external commands, -n removes the export`
+}
+func (c exportCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	exported := true
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-n":
+			exported = false
+		case "-p":
+		default:
+			return ctx, fmt.Errorf("%s: %s: invalid option\nusage: %s", c.Name(), args[0], c.Usage())
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 {
+		out := api.GetStdout(ctx)
+		names := make([]string, 0, len(gosh.vars))
+		for name, v := range gosh.vars {
+			if v.exported {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(out, "export %s=%s\n", name, shellQuote(gosh.vars[name].value))
+		}
+		return ctx, nil
+	}
+
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !isName(name) {
+			return ctx, fmt.Errorf("%s: `%s': not a valid identifier", c.Name(), arg)
+		}
+		if hasValue {
+			gosh.setVar(name, value)
+		}
+		gosh.exportVar(name, exported)
+	}
+	return ctx, nil
+}
+
+// unsetCmd removes variables or functions from the session
+type unsetCmd string
+
+func (c unsetCmd) Name() string     { return string(c) }
+func (c unsetCmd) Usage() string    { return "unset [-v|-f] name[[index]] ..." }
+func (c unsetCmd) LongDesc() string { return "" }
+func (c unsetCmd) ShortDesc() string {
+	return `unsets shell variables or array elements, or functions with -f`
+}
+func (c unsetCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	funcs := false
+	for _, name := range args[1:] {
+		switch name {
+		case "-v":
+			funcs = false
+			continue
+		case "-f":
+			funcs = true
+			continue
+		}
+		if funcs {
+			gosh.unsetFunc(name)
+			continue
+		}
+		if base, index, ok := strings.Cut(name, "["); ok && strings.HasSuffix(index, "]") && isName(base) {
+			key := strings.TrimSuffix(index, "]")
+			if !gosh.isAssoc(base) {
+				if key, err = gosh.indexKey(base, key); err != nil {
+					return ctx, fmt.Errorf("%s: %v", c.Name(), err)
+				}
+			}
+			gosh.unsetElem(base, key)
+			continue
+		}
+		if !isName(name) {
+			return ctx, fmt.Errorf("%s: `%s': not a valid identifier", c.Name(), name)
+		}
+		gosh.unsetVar(name)
+	}
+	return ctx, nil
+}
+
+// exitCmd ends the shell session
+type exitCmd string
+
+func (c exitCmd) Name() string     { return string(c) }
+func (c exitCmd) Usage() string    { return "exit [status]" }
+func (c exitCmd) LongDesc() string { return "" }
+func (c exitCmd) ShortDesc() string {
+	return `exits the shell with the given status, or the status of the last command`
+}
+func (c exitCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	status := api.GetStatus(ctx)
+	if len(args) > 1 {
+		code, err := strconv.Atoi(args[1])
+		if err != nil {
+			return ctx, fmt.Errorf("%s: %s: numeric argument required", c.Name(), args[1])
+		}
+		status = code & 0xff
+	}
+	// only the prompt says goodbye, out of the way of the output
+	if gosh.interactive {
+		fmt.Fprintln(api.GetStderr(ctx), "exiting...")
+	}
+	return ctx, api.ExitShell(status)
+}
+
+// shiftCmd drops the first positional parameters
+type shiftCmd string
+
+func (c shiftCmd) Name() string     { return string(c) }
+func (c shiftCmd) Usage() string    { return "shift [n]" }
+func (c shiftCmd) LongDesc() string { return "" }
+func (c shiftCmd) ShortDesc() string {
+	return `shifts the positional parameters by n, $2 becomes $1 for n=1`
+}
+func (c shiftCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	n := 1
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 0 {
+			return ctx, fmt.Errorf("%s: %s: numeric argument required", c.Name(), args[1])
+		}
+	}
+	if n > len(gosh.params) {
+		return ctx, api.ExitStatus(1)
+	}
+	gosh.params = gosh.params[n:]
+	return ctx, nil
+}
+
+// sourceCmd runs the commands of a file in the current session
+type sourceCmd string
+
+func (c sourceCmd) Name() string     { return string(c) }
+func (c sourceCmd) Usage() string    { return c.Name() + " file [arg ...]" }
+func (c sourceCmd) LongDesc() string { return "" }
+func (c sourceCmd) ShortDesc() string {
+	return `runs a file in the current session, keeping the variables, functions, aliases, prompt and directory it sets`
+}
+func (c sourceCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(args) < 2 {
+		return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: filename argument required\nusage: %s", c.Name(), c.Usage())}
+	}
+	path := gosh.sourcePath(args[1])
+	f, err := os.Open(path)
+	if err != nil {
+		return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+	}
+	defer f.Close()
+
+	// arguments replace the positional parameters while the file runs
+	if len(args) > 2 {
+		params := gosh.params
+		gosh.params = args[2:]
+		defer func() { gosh.params = params }()
+	}
+	gosh.sourcing++
+	defer func() { gosh.sourcing-- }()
+
+	newCtx, err := gosh.run(ctx, f)
+	var ret funcReturn
+	switch {
+	case errors.As(err, &ret):
+		if ret == 0 {
+			return newCtx, nil
+		}
+		return newCtx, api.ExitStatus(ret)
+	case errors.As(err, new(syntaxError)):
+		// a syntax error only stops the sourced file
+		return newCtx, statusError{status: 2, msg: fmt.Sprintf("%s: %v", path, err)}
+	}
+	return newCtx, err
+}
+
+// sourcePath returns the path of a file to source, a name without a slash
+// is looked up in $PATH before the current directory
+func (gosh *Goshell) sourcePath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	path, _ := gosh.getVar("PATH")
+	for _, dir := range filepath.SplitList(path) {
+		candidate := filepath.Join(dir, name)
+		if info, err := os.Stat(candidate); err == nil && info.Mode().IsRegular() {
+			return candidate
+		}
+	}
+	return name
+}
+
+// shellOptions are the options that can be changed with shopt
+var shellOptions = map[string]string{
+	"dotglob":  "patterns match filenames starting with a dot",
+	"failglob": "a pattern matching no filenames is an error",
+	"nullglob": "a pattern matching no filenames expands to nothing",
+}
+
+// shoptCmd sets and unsets shell options
+type shoptCmd string
+
+func (c shoptCmd) Name() string  { return string(c) }
+func (c shoptCmd) Usage() string { return "shopt [-s|-u|-q] [option ...]" }
+func (c shoptCmd) LongDesc() string {
+	names := make([]string, 0, len(shellOptions))
+	for name := range shellOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&sb, "  %-10s %s\n", name, shellOptions[name])
+	}
+	return sb.String()
+}
+func (c shoptCmd) ShortDesc() string {
+	return `sets (-s), unsets (-u) or prints shell options`
+}
+func (c shoptCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+
+	mode := ""
+	args = args[1:]
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch args[0] {
+		case "-s", "-u", "-q", "-p":
+			mode = args[0]
+		default:
+			return ctx, fmt.Errorf("%s: %s: invalid option\nusage: %s", c.Name(), args[0], c.Usage())
+		}
+		args = args[1:]
+	}
+
+	names := args
+	if len(names) == 0 {
+		for name := range shellOptions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	out := api.GetStdout(ctx)
+	allSet := true
+	for _, name := range names {
+		if _, ok := shellOptions[name]; !ok {
+			return ctx, fmt.Errorf("%s: %s: invalid shell option name", c.Name(), name)
+		}
+		switch {
+		case mode == "-s" && len(args) > 0:
+			gosh.options[name] = true
+		case mode == "-u" && len(args) > 0:
+			gosh.options[name] = false
+		case mode == "-q":
+			allSet = allSet && gosh.options[name]
+		case mode == "-s" && !gosh.options[name], mode == "-u" && gosh.options[name]:
+			// without option names, -s and -u list the options that are
+			// on or off
+		default:
+			state := "off"
+			if gosh.options[name] {
+				state = "on"
+			}
+			fmt.Fprintf(out, "%-10s\t%s\n", name, state)
+		}
+	}
+	if !allSet {
+		return ctx, api.ExitStatus(1)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// promptCmd sets the prompt by returning a new context, as the prompt
+// plugin command does
+type promptCmd string
+
+func (c promptCmd) Name() string      { return string(c) }
+func (c promptCmd) Usage() string     { return c.Name() }
+func (c promptCmd) ShortDesc() string { return `sets the prompt` }
+func (c promptCmd) LongDesc() string  { return c.ShortDesc() }
+func (c promptCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	return context.WithValue(ctx, "gosh.prompt", args[1]), nil
+}
+
+func TestShellSource(t *testing.T) {
+	dir := t.TempDir()
+	lib := filepath.Join(dir, "lib.gosh")
+	os.WriteFile(lib, []byte(`# helpers
+LIB=loaded
+export EXPORTED=yes
+greet() { args hello $1; }
+alias hi='greet alias'
+prompt 'lib>'
+cd `+dir+`
+args "sourced with $# $*"
+`), 0644)
+	os.WriteFile(filepath.Join(dir, "ret.gosh"), []byte("args before\nreturn 4\nargs after\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "bad.gosh"), []byte("args ok\nargs )\nargs never\n"), 0644)
+
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.commands["prompt"] = promptCmd("prompt")
+	shell.commands["cd"] = cdTestCmd("cd")
+	shell.params = []string{"outer"}
+	ctx := shell.ctx
+	for _, line := range []string{"source " + lib + " a b", "args $LIB $EXPORTED $@", "greet world", "hi"} {
+		ctx, _ = shell.handle(ctx, line)
+	}
+	want := "[sourced with 2 a b]\n[loaded][yes][outer]\n[hello][world]\n[hello][alias]\n"
+	if got := out.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if prompt := api.GetPrompt(ctx); prompt != "lib>" {
+		t.Errorf("got prompt %q, want lib>", prompt)
+	}
+	if pwd, _ := shell.getVar("PWD"); pwd != dir {
+		t.Errorf("got PWD %q, want %q", pwd, dir)
+	}
+
+	tests := []scriptTest{
+		{". ret.gosh; args $?", "[before]\n[4]\n", 0},
+		{"source ./bad.gosh; args $?", "[ok]\n./bad.gosh: syntax error near unexpected token `)'\n[2]\n", 0},
+		{"source missing.gosh", "source: open missing.gosh: no such file or directory\n", 1},
+		{"source", "source: filename argument required\nusage: source file [arg ...]\n", 2},
+	}
+	runScripts(t, tests, nil)
+}
+
+// cdTestCmd changes the working directory like the cd plugin command
+type cdTestCmd string
+
+func (c cdTestCmd) Name() string      { return string(c) }
+func (c cdTestCmd) Usage() string     { return c.Name() }
+func (c cdTestCmd) ShortDesc() string { return `changes directory` }
+func (c cdTestCmd) LongDesc() string  { return c.ShortDesc() }
+func (c cdTestCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	return ctx, os.Chdir(args[1])
+}
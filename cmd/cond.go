@@ -0,0 +1,567 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// condCmd is a conditional command [[ expr ]]. Its words are not split nor
+// globbed, operators like && and < are kept as unquoted words.
+type condCmd struct {
+	words []word
+}
+
+// condClause parses [[ expr ]]
+func (p *parser) condClause() (node, error) {
+	p.pos += 2 // [[
+	cc := &condCmd{}
+	for {
+		for !p.eof() && (p.peek() == ' ' || p.peek() == '\t' || p.peek() == '\n') {
+			p.pos++
+		}
+		if p.eof() {
+			return nil, incomplete("unterminated [[")
+		}
+		if p.keyword() == "]]" {
+			p.pos += 2
+			break
+		}
+		op := ""
+		for _, o := range []string{"&&", "||", "(", ")", "<", ">"} {
+			if p.hasPrefix(o) {
+				op = o
+				break
+			}
+		}
+		if op != "" {
+			p.pos += len(op)
+			cc.words = append(cc.words, word{litPart{text: op}})
+			continue
+		}
+		w, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		if w == nil {
+			return nil, p.unexpected()
+		}
+		cc.words = append(cc.words, w)
+		if condOp(w) != "=~" {
+			continue
+		}
+		// the regular expression is one word up to a blank, keeping its
+		// parentheses and |
+		for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+			p.pos++
+		}
+		if p.eof() || p.peek() == '\n' || p.keyword() == "]]" {
+			continue
+		}
+		re, err := p.wordUntil(func(r rune) bool { return r == ' ' || r == '\t' || r == '\n' })
+		if err != nil {
+			return nil, err
+		}
+		cc.words = append(cc.words, re)
+	}
+	if len(cc.words) == 0 {
+		p.pos -= 2
+		return nil, p.unexpected()
+	}
+	return cc, nil
+}
+
+// condOp returns the text of a word made of a single unquoted literal,
+// which is how operators are written, or "" for any other word
+func condOp(w word) string {
+	if len(w) != 1 {
+		return ""
+	}
+	if lit, ok := w[0].(litPart); ok && !lit.quoted {
+		return lit.text
+	}
+	return ""
+}
+
+// execCond runs a conditional command, it fails when the expression is false
+// and with status 2 when it can't be evaluated
+func (gosh *Goshell) execCond(ctx context.Context, cc *condCmd) (context.Context, error) {
+	e := &condEval{gosh: gosh, ctx: ctx, words: cc.words}
+	ok, err := e.eval()
+	if err != nil {
+		return ctx, statusError{status: 2, msg: "[[: " + err.Error()}
+	}
+	if !ok {
+		return ctx, api.ExitStatus(1)
+	}
+	return ctx, nil
+}
+
+// condEval evaluates the words of [[ expr ]], operands are only expanded
+// when && and || need them
+type condEval struct {
+	gosh  *Goshell
+	ctx   context.Context
+	words []word
+	pos   int
+}
+
+func (e *condEval) eval() (bool, error) {
+	ok, err := e.or(false)
+	if err == nil && e.pos < len(e.words) {
+		err = fmt.Errorf("syntax error near `%s'", condOp(e.words[e.pos]))
+	}
+	return ok, err
+}
+
+// peek returns the operator at the current position, if any
+func (e *condEval) peek() string {
+	if e.pos < len(e.words) {
+		return condOp(e.words[e.pos])
+	}
+	return ""
+}
+
+// or evaluates a || b, skip is set where the result is already known and
+// only the syntax needs to be read
+func (e *condEval) or(skip bool) (bool, error) {
+	result, err := e.and(skip)
+	for err == nil && e.peek() == "||" {
+		e.pos++
+		var ok bool
+		ok, err = e.and(skip || result)
+		result = result || ok
+	}
+	return result, err
+}
+
+func (e *condEval) and(skip bool) (bool, error) {
+	result, err := e.not(skip)
+	for err == nil && e.peek() == "&&" {
+		e.pos++
+		var ok bool
+		ok, err = e.not(skip || !result)
+		result = result && ok
+	}
+	return result, err
+}
+
+func (e *condEval) not(skip bool) (bool, error) {
+	if e.peek() == "!" {
+		e.pos++
+		ok, err := e.not(skip)
+		return !ok, err
+	}
+	return e.primary(skip)
+}
+
+func (e *condEval) primary(skip bool) (bool, error) {
+	if e.pos >= len(e.words) {
+		return false, fmt.Errorf("expression expected")
+	}
+	if e.peek() == "(" {
+		e.pos++
+		ok, err := e.or(skip)
+		if err != nil {
+			return false, err
+		}
+		if e.peek() != ")" {
+			return false, fmt.Errorf("expected `)'")
+		}
+		e.pos++
+		return ok, nil
+	}
+
+	op := e.peek()
+	rest := len(e.words) - e.pos
+	if isUnaryTest(op) && rest >= 2 && !isCondBinary(condOp(e.words[e.pos+1])) {
+		e.pos += 2
+		if skip {
+			return false, nil
+		}
+		arg, err := e.expand(e.words[e.pos-1])
+		if err != nil {
+			return false, err
+		}
+		return unaryTest(op, arg), nil
+	}
+	if rest >= 2 && isCondBinary(condOp(e.words[e.pos+1])) {
+		if rest < 3 {
+			return false, fmt.Errorf("argument expected after `%s'", condOp(e.words[e.pos+1]))
+		}
+		left, op, right := e.words[e.pos], condOp(e.words[e.pos+1]), e.words[e.pos+2]
+		e.pos += 3
+		if skip {
+			return false, nil
+		}
+		return e.binary(left, op, right)
+	}
+
+	w := e.words[e.pos]
+	e.pos++
+	if skip {
+		return false, nil
+	}
+	s, err := e.expand(w)
+	return s != "", err
+}
+
+// binary evaluates a binary operator, the right side of = and != is a
+// pattern, the one of =~ a regular expression and numeric operands are
+// arithmetic expressions
+func (e *condEval) binary(left word, op string, right word) (bool, error) {
+	a, err := e.expand(left)
+	if err != nil {
+		return false, err
+	}
+	switch op {
+	case "=", "==", "!=":
+		pattern, err := e.gosh.expandPattern(e.ctx, e.gosh.expandTilde(right, false))
+		if err != nil {
+			return false, err
+		}
+		return matchPattern(pattern, a) == (op != "!="), nil
+	case "=~":
+		expr, err := e.expandRegexp(right)
+		if err != nil {
+			return false, err
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return false, fmt.Errorf("%s: invalid regular expression", expr)
+		}
+		return re.MatchString(a), nil
+	}
+
+	b, err := e.expand(right)
+	if err != nil {
+		return false, err
+	}
+	if numericTests[op] {
+		x, err := e.gosh.arith(a)
+		if err != nil {
+			return false, err
+		}
+		y, err := e.gosh.arith(b)
+		if err != nil {
+			return false, err
+		}
+		return compareInts(op, x, y), nil
+	}
+	return binaryTest(op, a, b)
+}
+
+func (e *condEval) expand(w word) (string, error) {
+	return e.gosh.expandString(e.ctx, e.gosh.expandTilde(w, false))
+}
+
+// expandRegexp expands the right side of =~, quoted characters only match
+// themselves
+func (e *condEval) expandRegexp(w word) (string, error) {
+	var sb strings.Builder
+	for _, part := range w {
+		var value string
+		if lit, ok := part.(litPart); ok {
+			value = lit.text
+		} else {
+			var err error
+			if value, err = e.gosh.expandPart(e.ctx, part); err != nil {
+				return "", err
+			}
+		}
+		if isQuoted(part) {
+			value = regexp.QuoteMeta(value)
+		}
+		sb.WriteString(value)
+	}
+	return sb.String(), nil
+}
+
+// isCondBinary reports whether op is a binary operator of [[
+func isCondBinary(op string) bool {
+	return op == "=~" || isBinaryTest(op)
+}
+
+// unaryTests are the unary operators shared by test and [[
+var unaryTests = map[string]func(string) bool{
+	"-e": fileTest(func(os.FileInfo) bool { return true }),
+	"-f": fileTest(func(info os.FileInfo) bool { return info.Mode().IsRegular() }),
+	"-d": fileTest(os.FileInfo.IsDir),
+	"-s": fileTest(func(info os.FileInfo) bool { return info.Size() > 0 }),
+	"-p": fileTest(func(info os.FileInfo) bool { return info.Mode()&os.ModeNamedPipe != 0 }),
+	"-S": fileTest(func(info os.FileInfo) bool { return info.Mode()&os.ModeSocket != 0 }),
+	"-c": fileTest(func(info os.FileInfo) bool { return info.Mode()&os.ModeCharDevice != 0 }),
+	"-b": fileTest(func(info os.FileInfo) bool {
+		return info.Mode()&os.ModeDevice != 0 && info.Mode()&os.ModeCharDevice == 0
+	}),
+	"-L": isSymlink,
+	"-h": isSymlink,
+	"-r": func(path string) bool { return syscall.Access(path, 4) == nil },
+	"-w": func(path string) bool { return syscall.Access(path, 2) == nil },
+	"-x": func(path string) bool { return syscall.Access(path, 1) == nil },
+	"-z": func(s string) bool { return s == "" },
+	"-n": func(s string) bool { return s != "" },
+}
+
+// fileTest returns a test on the file a path points to, which fails when
+// there is no such file
+func fileTest(ok func(os.FileInfo) bool) func(string) bool {
+	return func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && ok(info)
+	}
+}
+
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+func isUnaryTest(op string) bool {
+	_, ok := unaryTests[op]
+	return ok
+}
+
+func unaryTest(op, arg string) bool {
+	return unaryTests[op](arg)
+}
+
+// numericTests are the binary operators comparing integers
+var numericTests = map[string]bool{
+	"-eq": true, "-ne": true, "-lt": true, "-le": true, "-gt": true, "-ge": true,
+}
+
+func isBinaryTest(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", ">", "-nt", "-ot", "-ef":
+		return true
+	}
+	return numericTests[op]
+}
+
+// binaryTest evaluates the binary operators of test, = and != compare
+// strings
+func binaryTest(op, a, b string) (bool, error) {
+	switch op {
+	case "=", "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case ">":
+		return a > b, nil
+	case "-nt", "-ot":
+		ta, errA := modTime(a)
+		tb, errB := modTime(b)
+		if op == "-ot" {
+			ta, tb, errA, errB = tb, ta, errB, errA
+		}
+		// an existing file is newer than a missing one
+		return errA == nil && (errB != nil || ta > tb), nil
+	case "-ef":
+		ia, errA := os.Stat(a)
+		ib, errB := os.Stat(b)
+		return errA == nil && errB == nil && os.SameFile(ia, ib), nil
+	}
+
+	x, err := strconv.ParseInt(strings.TrimSpace(a), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", a)
+	}
+	y, err := strconv.ParseInt(strings.TrimSpace(b), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", b)
+	}
+	return compareInts(op, x, y), nil
+}
+
+func modTime(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.ModTime().UnixNano(), nil
+}
+
+func compareInts(op string, x, y int64) bool {
+	switch op {
+	case "-eq":
+		return x == y
+	case "-ne":
+		return x != y
+	case "-lt":
+		return x < y
+	case "-le":
+		return x <= y
+	case "-gt":
+		return x > y
+	}
+	return x >= y
+}
+
+// testCmd evaluates an expression with its arguments, as [ it needs a
+// closing ]. It is a builtin so that scripts don't fork /usr/bin/test for
+// every condition.
+type testCmd string
+
+func (c testCmd) Name() string { return string(c) }
+func (c testCmd) Usage() string {
+	if c == "[" {
+		return "[ expr ]"
+	}
+	return "test expr"
+}
+func (c testCmd) LongDesc() string {
+	return `  -e, -f, -d, -s, -L, -r, -w, -x file
+                   file exists, is a regular file, a directory, is not empty,
+                   a symbolic link, readable, writable or executable
+  -z, -n string    string is empty, or not
+  a = b, a != b    the strings are equal or not, a < b and a > b compare them
+  a -eq b          integers are equal, also -ne, -lt, -le, -gt and -ge
+  a -nt b          file a is newer than b, -ot older
+  ! expr, expr -a expr, expr -o expr, ( expr )
+`
+}
+func (c testCmd) ShortDesc() string {
+	return `evaluates a conditional expression, it fails when the expression is false`
+}
+func (c testCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	args = args[1:]
+	if c == "[" {
+		if len(args) == 0 || args[len(args)-1] != "]" {
+			return ctx, statusError{status: 2, msg: "[: missing `]'"}
+		}
+		args = args[:len(args)-1]
+	}
+	ok, err := testArgs(args)
+	if err != nil {
+		return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+	}
+	if !ok {
+		return ctx, api.ExitStatus(1)
+	}
+	return ctx, nil
+}
+
+// testArgs evaluates the arguments of test. Like POSIX requires, up to four
+// arguments are told apart by their number, so that test -n = -n works.
+func testArgs(args []string) (bool, error) {
+	switch len(args) {
+	case 0:
+		return false, nil
+	case 1:
+		return args[0] != "", nil
+	case 2:
+		if args[0] == "!" {
+			ok, err := testArgs(args[1:])
+			return !ok, err
+		}
+		if isUnaryTest(args[0]) {
+			return unaryTest(args[0], args[1]), nil
+		}
+		return false, fmt.Errorf("%s: unary operator expected", args[0])
+	case 3:
+		if isBinaryTest(args[1]) {
+			return binaryTest(args[1], args[0], args[2])
+		}
+		if args[0] == "!" {
+			ok, err := testArgs(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[2] == ")" {
+			return testArgs(args[1:2])
+		}
+	case 4:
+		if args[0] == "!" {
+			ok, err := testArgs(args[1:])
+			return !ok, err
+		}
+		if args[0] == "(" && args[3] == ")" {
+			return testArgs(args[1:3])
+		}
+	}
+	e := &testEval{args: args}
+	ok, err := e.or()
+	if err == nil && e.pos < len(e.args) {
+		err = fmt.Errorf("%s: unexpected argument", e.args[e.pos])
+	}
+	return ok, err
+}
+
+// testEval evaluates the arguments of test with -a, -o, ! and parentheses
+type testEval struct {
+	args []string
+	pos  int
+}
+
+func (e *testEval) peek() string {
+	if e.pos < len(e.args) {
+		return e.args[e.pos]
+	}
+	return ""
+}
+
+func (e *testEval) or() (bool, error) {
+	result, err := e.and()
+	for err == nil && e.peek() == "-o" {
+		e.pos++
+		var ok bool
+		ok, err = e.and()
+		result = result || ok
+	}
+	return result, err
+}
+
+func (e *testEval) and() (bool, error) {
+	result, err := e.not()
+	for err == nil && e.peek() == "-a" {
+		e.pos++
+		var ok bool
+		ok, err = e.not()
+		result = result && ok
+	}
+	return result, err
+}
+
+func (e *testEval) not() (bool, error) {
+	if e.peek() == "!" {
+		e.pos++
+		ok, err := e.not()
+		return !ok, err
+	}
+	return e.primary()
+}
+
+func (e *testEval) primary() (bool, error) {
+	rest := len(e.args) - e.pos
+	switch {
+	case rest == 0:
+		return false, fmt.Errorf("argument expected")
+	case e.peek() == "(":
+		e.pos++
+		ok, err := e.or()
+		if err != nil {
+			return false, err
+		}
+		if e.peek() != ")" {
+			return false, fmt.Errorf("`)' expected")
+		}
+		e.pos++
+		return ok, nil
+	case rest >= 3 && isBinaryTest(e.args[e.pos+1]):
+		e.pos += 3
+		return binaryTest(e.args[e.pos-2], e.args[e.pos-3], e.args[e.pos-1])
+	case rest >= 2 && isUnaryTest(e.peek()):
+		e.pos += 2
+		return unaryTest(e.args[e.pos-2], e.args[e.pos-1]), nil
+	}
+	e.pos++
+	return e.args[e.pos-1] != "", nil
+}
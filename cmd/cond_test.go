@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestShellTest(t *testing.T) {
+	dir := t.TempDir()
+	old, empty := filepath.Join(dir, "old"), filepath.Join(dir, "empty")
+	if err := os.WriteFile(old, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(empty, nil, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(old, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []scriptTest{
+		{"test -f $D/old", "", 0},
+		{"[ -f $D ]", "", 1},
+		{"[ -d $D ] && [ -e $D/old ] && [ ! -e $D/none ]", "", 0},
+		{"[ -s $D/old ] && [ ! -s $D/empty ]", "", 0},
+		{"[ -L $D/link ] && [ ! -L $D/old ] && [ -f $D/link ]", "", 0},
+		{"[ -r $D/old -a -w $D/old ] && [ -x $D/empty ] && [ ! -x $D/old ]", "", 0},
+		{"[ $D/empty -nt $D/old ] && [ $D/old -ot $D/empty ] && [ $D/old -nt $D/none ]", "", 0},
+		{"[ -z '' ] && [ -n x ] && [ ! -n '' ]", "", 0},
+		{"[ abc = abc ] && [ abc != abd ] && [ a '<' b ] && [ b '>' a ]", "", 0},
+		{"[ 3 -lt 10 ] && [ 10 -gt 3 ] && [ 3 -eq 3 ] && [ 3 -ne 4 ] && [ 3 -le 3 ] && [ 3 -ge 3 ]", "", 0},
+		{"[ 3 -gt 10 ]", "", 1},
+		{"[ -n ] && [ = ] && [ -n = -n ] && [ ! ] && [ '(' x ')' ]", "", 0},
+		{"[ ]; args $?; test; args $?", "[1]\n[1]\n", 0},
+		{"[ x = x -o x = y ] && [ ! '(' x = y -a x = x ')' ]", "", 0},
+		{"[ a -lt 1 ]", "[: a: integer expression expected\n", 2},
+		{"[ -q x ]", "[: -q: unary operator expected\n", 2},
+		{"[ x = x", "[: missing `]'\n", 2},
+		{"[[ -f $D/old && ( a < b || 1 -eq 2 ) ]]", "", 0},
+		{"[[ -d $D/old || ! -e $D/none ]]", "", 0},
+		{"[[ main.go == *.go ]] && [[ main.go != *.c ]] && [[ main.go = m* ]]", "", 0},
+		{"[[ main.go == '*.go' ]]", "", 1},
+		{"P='*.go'; [[ main.go == $P ]] && ! [[ main.go == \"$P\" ]]", "", 0},
+		{"X='a b'; [[ $X = 'a b' && -n $X && -z $UNSET ]]", "", 0},
+		{"[[ abc123 =~ ^[a-z]+[0-9]+$ ]] && ! [[ abc =~ [0-9] ]]", "", 0},
+		{"[[ axb =~ a.b ]] && ! [[ axb =~ a\".\"b ]]", "", 0},
+		{"[[ ab =~ ^(a|b)+$ ]] && ! [[ abc =~ ^(a|b)+$ ]] && [[ 'x<y' =~ ^(x<|z)y$ ]]", "", 0},
+		{"re='(a|b)'; [[ b =~ ^${re}$ ]] && [[ a =~ ^\"(a|b)\"$ ]] || args no", "[no]\n", 0},
+		{"[[ 2+2 -eq 4 ]] && [[ 10 -gt 9 ]] && [[ b > a ]]", "", 0},
+		{"[[ 1 -eq 2 && $(args side) ]]", "", 1},
+		{"[[ x ==\n  x ]]; args $?", "[0]\n", 0},
+		{"if [[ -d $D ]]; then args dir; fi", "[dir]\n", 0},
+		{"[[ a =~ ( ]]", "[[: (: invalid regular expression\n", 2},
+		{"[[ a == ]]", "[[: argument expected after `=='\n", 2},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.setVar("D", dir)
+	})
+}
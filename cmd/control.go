@@ -0,0 +1,523 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// reservedWords are recognized as keywords where a command starts
+var reservedWords = map[string]bool{
+	"if": true, "then": true, "elif": true, "else": true, "fi": true,
+	"while": true, "until": true, "do": true, "done": true,
+	"for": true, "in": true, "case": true, "esac": true, "!": true,
+	"{": true, "}": true, "function": true, "[[": true, "]]": true,
+}
+
+// groupCmd runs a list of commands grouped with { list; }
+type groupCmd struct {
+	body node
+}
+
+// ifCmd runs the body following the first condition that succeeds, or
+// elseBody when none does
+type ifCmd struct {
+	conds    []node
+	bodies   []node
+	elseBody node
+}
+
+// loopCmd runs body as long as cond succeeds, or until it succeeds for an
+// until loop
+type loopCmd struct {
+	until bool
+	cond  node
+	body  node
+}
+
+// forCmd runs body once for each field words expand to, with the variable
+// name set to the field. Without in, it loops over the positional
+// parameters.
+type forCmd struct {
+	name  string
+	words []word
+	hasIn bool
+	body  node
+}
+
+// caseCmd runs the body of the first item with a pattern matching subject
+type caseCmd struct {
+	subject word
+	items   []caseItem
+}
+
+type caseItem struct {
+	patterns []word
+	body     node
+}
+
+// redirCmd is a compound command followed by redirections, which apply to
+// every command it runs
+type redirCmd struct {
+	cmd    node
+	redirs []*redirect
+}
+
+// keyword returns the reserved word at the current position, or "" if
+// there is none
+func (p *parser) keyword() string {
+	end := p.pos
+	for end < len(p.src) && !isMeta(p.src[end]) {
+		end++
+	}
+	if w := string(p.src[p.pos:end]); reservedWords[w] {
+		return w
+	}
+	return ""
+}
+
+// expect consumes the reserved word kw, which must come next
+func (p *parser) expect(kw string) error {
+	p.skipBlanks()
+	if p.keyword() != kw {
+		return p.unexpected()
+	}
+	p.pos += len(kw)
+	return nil
+}
+
+// body parses a list that must hold at least one command
+func (p *parser) body() (node, error) {
+	list, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		p.skipBlanks()
+		return nil, p.unexpected()
+	}
+	return list, nil
+}
+
+// command parses a compound command with its redirections, or a simple
+// command. A nil node is returned at a reserved word ending the enclosing
+// compound command.
+func (p *parser) command() (node, error) {
+	p.skipBlanks()
+	for p.keyword() == "" && p.expandAlias() {
+		p.skipBlanks()
+	}
+	var cmd node
+	var err error
+	switch kw := p.keyword(); kw {
+	case "if":
+		cmd, err = p.ifClause()
+	case "while", "until":
+		cmd, err = p.loop(kw)
+	case "for":
+		cmd, err = p.forClause()
+	case "case":
+		cmd, err = p.caseClause()
+	case "{":
+		cmd, err = p.group()
+	case "[[":
+		cmd, err = p.condClause()
+	case "function":
+		return p.funcDef()
+	case "":
+		if p.hasPrefix("((") {
+			cmd, err = p.arithCommand()
+			break
+		}
+		if p.isFuncDef() {
+			return p.funcDef()
+		}
+		sc, err := p.simpleCommand()
+		if sc == nil || err != nil {
+			return nil, err
+		}
+		return sc, nil
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var redirs []*redirect
+	for {
+		p.skipBlanks()
+		redir, ok, err := p.redirect()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		redirs = append(redirs, redir)
+		if redir.op == "<<" || redir.op == "<<-" {
+			p.heredocs = append(p.heredocs, redir)
+		}
+	}
+	if p.skipBlanks(); !p.eof() && !isMeta(p.peek()) {
+		return nil, p.unexpected()
+	}
+	if len(redirs) > 0 {
+		return &redirCmd{cmd: cmd, redirs: redirs}, nil
+	}
+	return cmd, nil
+}
+
+// group parses { list; }
+func (p *parser) group() (node, error) {
+	p.pos++ // {
+	body, err := p.body()
+	if err != nil {
+		return nil, err
+	}
+	return &groupCmd{body: body}, p.expect("}")
+}
+
+// ifClause parses if list; then list; [elif list; then list;]... [else
+// list;] fi
+func (p *parser) ifClause() (node, error) {
+	cmd := &ifCmd{}
+	for kw := "if"; kw == "if" || kw == "elif"; kw = p.keyword() {
+		p.pos += len(kw)
+		cond, err := p.body()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("then"); err != nil {
+			return nil, err
+		}
+		body, err := p.body()
+		if err != nil {
+			return nil, err
+		}
+		cmd.conds = append(cmd.conds, cond)
+		cmd.bodies = append(cmd.bodies, body)
+		p.skipBlanks()
+	}
+	if p.keyword() == "else" {
+		p.pos += len("else")
+		body, err := p.body()
+		if err != nil {
+			return nil, err
+		}
+		cmd.elseBody = body
+	}
+	return cmd, p.expect("fi")
+}
+
+// loop parses while list; do list; done and its until counterpart
+func (p *parser) loop(kw string) (node, error) {
+	p.pos += len(kw)
+	cmd := &loopCmd{until: kw == "until"}
+	var err error
+	if cmd.cond, err = p.body(); err != nil {
+		return nil, err
+	}
+	if cmd.body, err = p.doGroup(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// doGroup parses do list; done
+func (p *parser) doGroup() (node, error) {
+	if err := p.expect("do"); err != nil {
+		return nil, err
+	}
+	body, err := p.body()
+	if err != nil {
+		return nil, err
+	}
+	return body, p.expect("done")
+}
+
+// forClause parses for name [in word ...]; do list; done
+func (p *parser) forClause() (node, error) {
+	p.pos += len("for")
+	p.skipBlanks()
+	start := p.pos
+	for !p.eof() && !isMeta(p.peek()) {
+		p.pos++
+	}
+	cmd := &forCmd{name: string(p.src[start:p.pos])}
+	if !isName(cmd.name) {
+		p.pos = start
+		return nil, p.unexpected()
+	}
+
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	if p.keyword() == "in" {
+		p.pos += len("in")
+		cmd.hasIn = true
+		for p.skipBlanks(); !p.eof() && !isMeta(p.peek()); p.skipBlanks() {
+			w, err := p.word()
+			if err != nil {
+				return nil, err
+			}
+			cmd.words = append(cmd.words, w)
+		}
+	}
+	if p.peek() == ';' {
+		p.pos++
+	}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if cmd.body, err = p.doGroup(); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// caseClause parses case word in [(]pattern[|pattern]...) list;; ... esac
+func (p *parser) caseClause() (node, error) {
+	p.pos += len("case")
+	p.skipBlanks()
+	if p.eof() || isMeta(p.peek()) {
+		return nil, p.unexpected()
+	}
+	subject, err := p.word()
+	if err != nil {
+		return nil, err
+	}
+	cmd := &caseCmd{subject: subject}
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("in"); err != nil {
+		return nil, err
+	}
+
+	for {
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+		if p.keyword() == "esac" {
+			p.pos += len("esac")
+			return cmd, nil
+		}
+
+		var item caseItem
+		if p.peek() == '(' {
+			p.pos++
+		}
+		for {
+			p.skipBlanks()
+			if p.eof() || isMeta(p.peek()) {
+				return nil, p.unexpected()
+			}
+			pattern, err := p.word()
+			if err != nil {
+				return nil, err
+			}
+			item.patterns = append(item.patterns, pattern)
+			if p.skipBlanks(); p.peek() != '|' {
+				break
+			}
+			p.pos++
+		}
+		if p.peek() != ')' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+
+		if item.body, err = p.list(); err != nil {
+			return nil, err
+		}
+		cmd.items = append(cmd.items, item)
+		p.skipBlanks()
+		switch {
+		case p.hasPrefix(";;"):
+			p.pos += 2
+		case p.keyword() != "esac":
+			return nil, p.unexpected()
+		}
+	}
+}
+
+// loopJump is returned by break and continue, it unwinds the commands
+// run by a loop body up to the n-th enclosing loop
+type loopJump struct {
+	cont bool
+	n    int
+}
+
+func (j loopJump) Error() string {
+	if j.cont {
+		return "continue"
+	}
+	return "break"
+}
+func (j loopJump) ExitCode() int { return 0 }
+
+// unwinds reports whether err stops the commands that follow it, as
+// exiting the shell, leaving a loop or returning from a function do
+func unwinds(err error) bool {
+	var jump loopJump
+	var ret funcReturn
+	var intr interrupted
+	var cancel cancelled
+	return isExit(err) || errors.As(err, &jump) || errors.As(err, &ret) || errors.As(err, &intr) || errors.As(err, &cancel)
+}
+
+// execIf runs an if command, its status is the status of the body it ran
+// or 0 when no condition succeeded
+func (gosh *Goshell) execIf(ctx context.Context, ic *ifCmd) (context.Context, error) {
+	for i, cond := range ic.conds {
+		var err error
+		if ctx, err = gosh.condition(ctx, cond); unwinds(err) {
+			return ctx, err
+		}
+		if err == nil {
+			return gosh.exec(ctx, ic.bodies[i])
+		}
+		gosh.reportError(ctx, err)
+	}
+	if ic.elseBody != nil {
+		return gosh.exec(ctx, ic.elseBody)
+	}
+	return ctx, nil
+}
+
+// execLoop runs a while or until loop, its status is the status of the
+// last body run
+func (gosh *Goshell) execLoop(ctx context.Context, lc *loopCmd) (context.Context, error) {
+	var result error
+	for {
+		var err error
+		if ctx, err = gosh.condition(ctx, lc.cond); unwinds(err) {
+			return ctx, err
+		}
+		if err != nil {
+			gosh.reportError(ctx, err)
+		}
+		if (err == nil) == lc.until {
+			return ctx, result
+		}
+		var next bool
+		if ctx, result, next = gosh.execLoopBody(ctx, lc.body); !next {
+			return ctx, result
+		}
+	}
+}
+
+// execFor runs a for loop
+func (gosh *Goshell) execFor(ctx context.Context, fc *forCmd) (context.Context, error) {
+	values := gosh.params
+	if fc.hasIn {
+		var err error
+		if values, err = gosh.expandWords(ctx, fc.words); err != nil {
+			return ctx, err
+		}
+	}
+	var result error
+	for _, value := range values {
+		gosh.setVar(fc.name, value)
+		var next bool
+		if ctx, result, next = gosh.execLoopBody(ctx, fc.body); !next {
+			break
+		}
+	}
+	return ctx, result
+}
+
+// execLoopBody runs one iteration of a loop and reports whether the loop
+// goes on, handling break and continue
+func (gosh *Goshell) execLoopBody(ctx context.Context, body node) (context.Context, error, bool) {
+	gosh.loopDepth++
+	ctx, err := gosh.exec(ctx, body)
+	gosh.loopDepth--
+
+	var jump loopJump
+	switch {
+	case errors.As(err, &jump) && jump.n > 1:
+		return ctx, loopJump{cont: jump.cont, n: jump.n - 1}, false
+	case errors.As(err, &jump):
+		return ctx, nil, jump.cont
+	case unwinds(err):
+		return ctx, err, false
+	}
+	if err != nil {
+		// the error is reported once, the loop only keeps its status
+		gosh.reportError(ctx, err)
+		err = api.ExitStatus(api.Status(err))
+	}
+	return ctx, err, true
+}
+
+// execCase runs the body of the first item matching the case subject
+func (gosh *Goshell) execCase(ctx context.Context, cc *caseCmd) (context.Context, error) {
+	subject, err := gosh.expandString(ctx, gosh.expandTilde(cc.subject, false))
+	if err != nil {
+		return ctx, err
+	}
+	for _, item := range cc.items {
+		for _, p := range item.patterns {
+			pattern, err := gosh.expandPattern(ctx, gosh.expandTilde(p, false))
+			if err != nil {
+				return ctx, err
+			}
+			if !matchPattern(pattern, subject) {
+				continue
+			}
+			if item.body == nil {
+				return ctx, nil
+			}
+			return gosh.exec(ctx, item.body)
+		}
+	}
+	return ctx, nil
+}
+
+// execRedirected runs a compound command with its redirections applied
+func (gosh *Goshell) execRedirected(ctx context.Context, rc *redirCmd) (context.Context, error) {
+	redirCtx, closeFiles, err := gosh.redirect(ctx, rc.redirs)
+	if err != nil {
+		return ctx, err
+	}
+	defer closeFiles()
+	newCtx, err := gosh.exec(redirCtx, rc.cmd)
+	return restoreStreams(newCtx, ctx), gosh.reportRedirected(newCtx, err)
+}
+
+// loopCtlCmd implements break and continue
+type loopCtlCmd string
+
+func (c loopCtlCmd) Name() string     { return string(c) }
+func (c loopCtlCmd) Usage() string    { return string(c) + " [n]" }
+func (c loopCtlCmd) LongDesc() string { return "" }
+func (c loopCtlCmd) ShortDesc() string {
+	if c == "continue" {
+		return `resumes the next iteration of the n-th enclosing loop`
+	}
+	return `exits from the n-th enclosing for, while or until loop`
+}
+func (c loopCtlCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	n := 1
+	if len(args) > 1 {
+		if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+			return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %s: loop count out of range", c.Name(), args[1])}
+		}
+	}
+	if gosh.loopDepth == 0 {
+		fmt.Fprintf(api.GetStderr(ctx), "%s: only meaningful in a `for', `while', or `until' loop\n", c.Name())
+		return ctx, nil
+	}
+	return ctx, loopJump{cont: c == "continue", n: min(n, gosh.loopDepth)}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShellControlFlow(t *testing.T) {
+	tests := []scriptTest{
+		{"if true; then args yes; fi", "[yes]\n", 0},
+		{"if false; then args yes; fi", "", 0},
+		{"if false; then args 1; elif false; then args 2; else args 3; fi", "[3]\n", 0},
+		{"if false; then args 1; elif true; then args 2; else args 3; fi", "[2]\n", 0},
+		{"if true; then false; fi", "", 1},
+		{"if\n  ! false\nthen\n  args negated\nfi", "[negated]\n", 0},
+		{"if nosuch; then args 1; fi", "command not found: nosuch\n", 0},
+		{"for x in a 'b c' d; do args $x; done", "[a]\n[b][c]\n[d]\n", 0},
+		{"for x in {1..3}; do args \"$x\"; done; args $x", "[1]\n[2]\n[3]\n[3]\n", 0},
+		{"for x in; do args $x; done", "", 0},
+		{"for p; do args $p; done", "[one]\n[two]\n", 0},
+		{"for x in a b c\ndo\n  args $x\ndone | upper", "[A]\n[B]\n[C]\n", 0},
+		{"X=aaa; while [ $X != a ]; do X=${X%a}; args $X; done", "[aa]\n[a]\n", 0},
+		{"X=; until [ \"$X\" = aa ]; do X=a$X; args $X; done", "[a]\n[aa]\n", 0},
+		{"while false; do args never; done", "", 0},
+		{"for x in 1 2 3 4; do if [ $x = 2 ]; then continue; fi; if [ $x = 4 ]; then break; fi; args $x; done", "[1]\n[3]\n", 0},
+		{"for x in a b; do for y in 1 2; do args $x$y; continue 2; done; done", "[a1]\n[b1]\n", 0},
+		{"for x in a b; do for y in 1 2; do args $x$y; break 2; done; done; args after", "[a1]\n[after]\n", 0},
+		{"while true; do break; done; args $?", "[0]\n", 0},
+		{"break; args $?", "break: only meaningful in a `for', `while', or `until' loop\n[0]\n", 0},
+		{"for x in a b; do false; done", "", 1},
+		{"case main.go in *.md) args doc;; *.go | *.c) args source;; *) args other;; esac", "[source]\n", 0},
+		{"case x in\n  (y) args y ;;\n  x)\n    args x\n    ;;\nesac", "[x]\n", 0},
+		{"X='*'; case a in \"$X\") args quoted;; $X) args pattern;; esac", "[pattern]\n", 0},
+		{"case none in a) args a;; esac; args $?", "[0]\n", 0},
+		{"case a in a) ;; esac; args empty", "[empty]\n", 0},
+		{"for x in a b; do args $x; done > /dev/null; args done", "[done]\n", 0},
+		{"while true; do upper; break; done <<EOF\nheredoc\nEOF", "HEREDOC\n", 0},
+		{"args if then fi done", "[if][then][fi][done]\n", 0},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.params = []string{"one", "two"}
+	})
+}
+
+func TestParseControlFlow(t *testing.T) {
+	incomplete := []string{
+		"if true; then\n", "if true; then args; else\n", "while true\n", "for x in a b\n",
+		"for x in a; do args\n", "case x in\n", "case x in x) args;;\n",
+	}
+	for _, line := range incomplete {
+		if _, err := parse(line); !errors.Is(err, errIncomplete) {
+			t.Errorf("%q: got %v, want an incomplete input error", line, err)
+		}
+	}
+
+	invalid := map[string]string{
+		"fi":                       "syntax error near unexpected token `fi'",
+		"if true; fi":              "syntax error near unexpected token `fi'",
+		"if; then args; fi":        "syntax error near unexpected token `;'",
+		"while true; done":         "syntax error near unexpected token `done'",
+		"for 1 in a; do :; done":   "syntax error near unexpected token `1'",
+		"if true; then args; fi x": "syntax error near unexpected token `x'",
+	}
+	for line, want := range invalid {
+		_, err := parse(line)
+		if err == nil || err.Error() != want {
+			t.Errorf("%q: got %v, want %s", line, err, want)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// statusError is an error reported by the shell itself, along with the
+// exit status it sets
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e statusError) Error() string { return e.msg }
+func (e statusError) ExitCode() int { return e.status }
+
+// exec runs a command tree and records its exit status as $?
+func (gosh *Goshell) exec(ctx context.Context, n node) (context.Context, error) {
+	// a cancelled context stops the commands left, unwinding functions,
+	// loops and sourced files
+	if err := cancelCause(ctx); err != nil {
+		gosh.status = api.Status(err)
+		return ctx, err
+	}
+	runCtx := ctx
+	var err error
+	switch n := n.(type) {
+	case *simpleCmd:
+		ctx, err = gosh.execSimple(ctx, n)
+		err = gosh.failed(ctx, err)
+	case *pipeline:
+		run := gosh.exec
+		if n.negate {
+			// set -e ignores a negated pipeline
+			run = gosh.condition
+		}
+		if len(n.cmds) == 1 {
+			ctx, err = run(ctx, n.cmds[0])
+		} else {
+			ctx, err = gosh.execPipeline(ctx, n)
+		}
+		if !n.negate {
+			err = gosh.failed(ctx, err)
+		} else if !unwinds(err) {
+			// ! inverts the status of the pipeline
+			if err == nil {
+				err = api.ExitStatus(1)
+			} else {
+				gosh.reportError(ctx, err)
+				err = nil
+			}
+		}
+	case *andOrCmd:
+		ctx, err = gosh.execAndOr(ctx, n)
+	case *cmdList:
+		ctx, err = gosh.execList(ctx, n)
+	case *ifCmd:
+		ctx, err = gosh.execIf(ctx, n)
+	case *loopCmd:
+		ctx, err = gosh.execLoop(ctx, n)
+	case *forCmd:
+		ctx, err = gosh.execFor(ctx, n)
+	case *caseCmd:
+		ctx, err = gosh.execCase(ctx, n)
+	case *redirCmd:
+		ctx, err = gosh.execRedirected(ctx, n)
+	case *condCmd:
+		ctx, err = gosh.execCond(ctx, n)
+		err = gosh.failed(ctx, err)
+	case *arithCmd:
+		ctx, err = gosh.execArith(ctx, n)
+		err = gosh.failed(ctx, err)
+	case *groupCmd:
+		ctx, err = gosh.exec(ctx, n.body)
+	case *funcDef:
+		gosh.defineFunc(n)
+	case *backgroundCmd:
+		ctx, err = gosh.execBackground(ctx, n)
+	default:
+		err = fmt.Errorf("unsupported command node %T", n)
+	}
+	// an unset variable with set -u ends a script
+	if errors.As(err, new(unboundError)) && !gosh.interactive {
+		gosh.reportError(ctx, err)
+		err = api.ExitShell(api.Status(err))
+	}
+	gosh.status = api.Status(err)
+	if sigErr := gosh.checkSignals(ctx); sigErr != nil {
+		err = sigErr
+		gosh.status = api.Status(err)
+	}
+	if cancelErr := cancelCause(runCtx); cancelErr != nil && !unwinds(err) {
+		err = cancelErr
+		gosh.status = api.Status(err)
+	}
+	return ctx, err
+}
+
+// isExit reports whether err ends the shell session
+func isExit(err error) bool {
+	var exit api.ExitShell
+	return errors.As(err, &exit)
+}
+
+// subshellError turns an exit from a subshell into its exit status, as it
+// only ends the subshell, and keeps break, continue and return inside it
+func subshellError(err error) error {
+	if unwinds(err) {
+		return api.ExitStatus(api.Status(err))
+	}
+	return err
+}
+
+// execSimple expands and dispatches a single command, plugin commands take
+// precedence over programs found in $PATH
+func (gosh *Goshell) execSimple(ctx context.Context, sc *simpleCmd) (context.Context, error) {
+	args, err := gosh.expandWords(ctx, sc.args)
+	if err != nil {
+		return ctx, err
+	}
+	// a command made of assignments only has the status of its last
+	// command substitution
+	gosh.substStatus = 0
+	assigns := make(map[string]string, len(sc.assigns))
+	traced := make([]string, 0, len(sc.assigns))
+	for _, as := range sc.assigns {
+		// array assignments always change the session
+		if len(args) == 0 || as.array || as.index != nil {
+			if err := gosh.assign(ctx, as); err != nil {
+				return ctx, err
+			}
+			traced = append(traced, gosh.tracedAssign(as.name))
+			continue
+		}
+		value, err := gosh.assignValue(ctx, as)
+		if err != nil {
+			return ctx, err
+		}
+		assigns[as.name] = value
+		traced = append(traced, as.name+"="+shellQuote(value))
+	}
+	gosh.trace(ctx, traced, args)
+
+	cmdCtx := ctx
+	if len(sc.redirs) > 0 {
+		redirCtx, closeFiles, err := gosh.redirect(ctx, sc.redirs)
+		if err != nil {
+			return ctx, err
+		}
+		defer closeFiles()
+		cmdCtx = redirCtx
+	}
+	if len(args) == 0 {
+		if gosh.substStatus != 0 {
+			return ctx, api.ExitStatus(gosh.substStatus)
+		}
+		return ctx, nil
+	}
+	if len(assigns) > 0 {
+		defer gosh.withAssigns(assigns)()
+	}
+	// a program stopped on its own becomes a job named after the command
+	if gosh.tty != nil {
+		cmdCtx = context.WithValue(cmdCtx, "gosh.jobtext", sc.text)
+	}
+
+	newCtx, err := gosh.runCommand(cmdCtx, args)
+	if len(sc.redirs) > 0 {
+		if newCtx != nil {
+			newCtx = restoreStreams(newCtx, ctx)
+		}
+		err = gosh.reportRedirected(cmdCtx, err)
+	}
+	return newCtx, err
+}
+
+// cancelGrace is how long a plugin command whose context was cancelled
+// may take to return, it is abandoned after that
+var cancelGrace = 2 * time.Second
+
+// runCommand runs the expanded command args, a command registered in the
+// session or else a program found in $PATH
+func (gosh *Goshell) runCommand(ctx context.Context, args []string) (context.Context, error) {
+	cmd, ok := gosh.commands[args[0]]
+	if !ok {
+		return ctx, gosh.externalExec(ctx, args[0], args)
+	}
+	return gosh.callCommand(ctx, cmd, args)
+}
+
+// callCommand runs a command of the session, a builtin, plugin command or
+// function, with its own context
+func (gosh *Goshell) callCommand(ctx context.Context, cmd api.Command, args []string) (context.Context, error) {
+	ctx = context.WithValue(ctx, "gosh.shell", gosh)
+	ctx = context.WithValue(ctx, "gosh.status", gosh.status)
+	// Ctrl+C, a timeout or the shell exiting cancel the context of the
+	// command, which must not outlive it
+	runCtx, done := gosh.fg.command(ctx)
+	var newCtx context.Context
+	var err error
+	if gosh.isShellCommand(args[0], cmd) {
+		// builtins and functions run in the session, shell code stops
+		// once its context is cancelled
+		newCtx, err = cmd.Exec(runCtx, args)
+	} else {
+		newCtx, err = gosh.runPlugin(runCtx, cmd, args)
+	}
+	// a command failing as it is cancelled fails because it was, whatever
+	// error it returned
+	var intr interrupted
+	if cause := context.Cause(runCtx); err != nil && errors.As(cause, &intr) {
+		err = api.ExitStatus(intr.ExitCode())
+	} else if err != nil && cause != nil {
+		err = cancelled{cause}
+	}
+	done()
+	if newCtx != nil && newCtx.Err() != nil {
+		newCtx = commandCtx{ctx, context.WithoutCancel(newCtx)}
+	}
+	gosh.updatePwd()
+	return newCtx, err
+}
+
+// commandCtx is the context a command returned, which keeps its values but
+// is cancelled with the context the command ran with rather than its own.
+// Its cause is its error.
+type commandCtx struct {
+	context.Context
+	values context.Context
+}
+
+func (c commandCtx) Value(key any) any { return c.values.Value(key) }
+
+// isShellCommand reports whether cmd is a builtin or a function rather
+// than a plugin command
+func (gosh *Goshell) isShellCommand(name string, cmd api.Command) bool {
+	if _, ok := cmd.(*funcCmd); ok {
+		return true
+	}
+	builtin, ok := gosh.builtins[name]
+	return ok && cmd == builtin
+}
+
+// runPlugin calls the Exec of a plugin command. Once ctx is cancelled, a
+// command that doesn't return within cancelGrace is reported and left
+// running on its own, its result is dropped.
+func (gosh *Goshell) runPlugin(ctx context.Context, cmd api.Command, args []string) (context.Context, error) {
+	type result struct {
+		ctx context.Context
+		err error
+	}
+	returned := make(chan result, 1)
+	go func() {
+		newCtx, err := cmd.Exec(ctx, args)
+		returned <- result{newCtx, err}
+	}()
+	select {
+	case res := <-returned:
+		return res.ctx, res.err
+	case <-ctx.Done():
+	}
+	grace := time.NewTimer(cancelGrace)
+	defer grace.Stop()
+	select {
+	case res := <-returned:
+		return res.ctx, res.err
+	case <-grace.C:
+		fmt.Fprintf(api.GetStderr(ctx), "gosh: %s: still running %v after being cancelled, abandoned\n", args[0], cancelGrace)
+		return ctx, context.Cause(ctx)
+	}
+}
+
+// execPipeline runs every stage of a pipeline concurrently, each stage's
+// gosh.stdout is connected to the next stage's gosh.stdin through an OS
+// pipe. The pipeline's result is the result of its last stage and, as
+// stages run in subshells, changes they make to the session are dropped.
+func (gosh *Goshell) execPipeline(ctx context.Context, pl *pipeline) (context.Context, error) {
+	errs := make([]error, len(pl.cmds))
+	var wg sync.WaitGroup
+	stdin := api.GetStdin(ctx)
+	// the external commands of the stages share a process group
+	pipeCtx := ctx
+	if _, ok := ctx.Value("gosh.pgroup").(*procGroup); !ok && gosh.tty != nil {
+		pg := &procGroup{text: pl.text}
+		pipeCtx = context.WithValue(ctx, "gosh.pgroup", pg)
+		// the stopped stages are reported together, as one job
+		defer func() {
+			gosh.reportStopped(ctx, pg)
+			gosh.releaseGroup(pg)
+		}()
+	}
+	for i, cmd := range pl.cmds {
+		stdout := api.GetStdout(ctx)
+		var next io.Reader
+		if i < len(pl.cmds)-1 {
+			pr, pw, err := os.Pipe()
+			if err != nil {
+				errs[len(errs)-1] = err
+				if in, ok := stdin.(*os.File); ok && i > 0 {
+					in.Close()
+				}
+				break
+			}
+			stdout, next = pw, pr
+		}
+		stageCtx := context.WithValue(pipeCtx, "gosh.stdin", stdin)
+		stageCtx = context.WithValue(stageCtx, "gosh.stdout", stdout)
+
+		wg.Add(1)
+		go func(i int, cmd node, stdin io.Reader, stdout io.Writer) {
+			defer wg.Done()
+			_, err := gosh.subshell().exec(stageCtx, cmd)
+			errs[i] = subshellError(err)
+			// close this stage's pipe ends so that its neighbours see
+			// EOF or a broken pipe
+			if out, ok := stdout.(*os.File); ok && i < len(pl.cmds)-1 {
+				out.Close()
+			}
+			if in, ok := stdin.(*os.File); ok && i > 0 {
+				in.Close()
+			}
+		}(i, cmd, stdin, stdout)
+		stdin = next
+	}
+	wg.Wait()
+
+	for _, err := range errs[:len(errs)-1] {
+		if err != nil {
+			gosh.reportError(ctx, err)
+		}
+	}
+	result := errs[len(errs)-1]
+	// with set -o pipefail, the last stage failing sets the status
+	for i := len(errs) - 2; i >= 0 && result == nil && gosh.options["pipefail"]; i-- {
+		if errs[i] != nil {
+			result = api.ExitStatus(api.Status(errs[i]))
+		}
+	}
+	return ctx, result
+}
+
+// execList runs commands one after the other, the list's result is the
+// result of its last command
+func (gosh *Goshell) execList(ctx context.Context, list *cmdList) (context.Context, error) {
+	var err error
+	for i, cmd := range list.cmds {
+		if gosh.options["noexec"] && !gosh.interactive {
+			break
+		}
+		if i > 0 && err != nil {
+			gosh.reportError(ctx, err)
+		}
+		if ctx, err = gosh.exec(ctx, cmd); unwinds(err) {
+			break
+		}
+	}
+	return ctx, err
+}
+
+// execAndOr runs the right side of && only when the left side succeeds and
+// the right side of || only when it fails
+func (gosh *Goshell) execAndOr(ctx context.Context, ao *andOrCmd) (context.Context, error) {
+	ctx, err := gosh.condition(ctx, ao.left)
+	if (ao.op == "&&") != (err == nil) || unwinds(err) {
+		return ctx, err
+	}
+	if err != nil {
+		gosh.reportError(ctx, err)
+	}
+	return gosh.exec(ctx, ao.right)
+}
+
+// reportRedirected reports the error of a command while its redirections
+// still apply, so it goes to the command's stderr, and returns the status
+// it leaves
+func (gosh *Goshell) reportRedirected(ctx context.Context, err error) error {
+	if err == nil || unwinds(err) {
+		return err
+	}
+	gosh.reportError(ctx, err)
+	return api.ExitStatus(api.Status(err))
+}
+
+// reportError prints the error of a failed command, unless it only
+// carries an exit status
+func (gosh *Goshell) reportError(ctx context.Context, err error) {
+	var status api.ExitStatus
+	var intr interrupted
+	var cancel cancelled
+	if errors.As(err, &status) || errors.As(err, &intr) || errors.As(err, &cancel) || isExit(err) {
+		return
+	}
+	fmt.Fprintf(api.GetStderr(ctx), "%v\n", err)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// upperCmd is a test command that upper-cases its stdin
+type upperCmd string
+
+func (c upperCmd) Name() string      { return string(c) }
+func (c upperCmd) Usage() string     { return c.Name() }
+func (c upperCmd) ShortDesc() string { return `upper-cases stdin` }
+func (c upperCmd) LongDesc() string  { return c.ShortDesc() }
+func (c upperCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	out := api.GetStdout(ctx)
+	scanner := bufio.NewScanner(api.GetStdin(ctx))
+	for scanner.Scan() {
+		fmt.Fprintln(out, strings.ToUpper(scanner.Text()))
+	}
+	return ctx, scanner.Err()
+}
+
+// argsCmd is a test command that prints each of its arguments in brackets
+type argsCmd string
+
+func (c argsCmd) Name() string      { return string(c) }
+func (c argsCmd) Usage() string     { return c.Name() }
+func (c argsCmd) ShortDesc() string { return `prints its arguments` }
+func (c argsCmd) LongDesc() string  { return c.ShortDesc() }
+func (c argsCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	out := api.GetStdout(ctx)
+	for _, arg := range args[1:] {
+		fmt.Fprintf(out, "[%s]", arg)
+	}
+	fmt.Fprintln(out)
+	return ctx, nil
+}
+
+// syncBuffer is a buffer that pipeline stages can write concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newTestShell returns a shell without plugins, writing to out
+func newTestShell(out io.Writer) *Goshell {
+	shell := New()
+	shell.commands["upper"] = upperCmd("upper")
+	shell.commands["args"] = argsCmd("args")
+	shell.ctx = context.WithValue(context.TODO(), "gosh.stdout", out)
+	shell.ctx = context.WithValue(shell.ctx, "gosh.stderr", out)
+	shell.ctx = context.WithValue(shell.ctx, "gosh.stdin", strings.NewReader(""))
+	return shell
+}
+
+func TestShellPipeline(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{`echo hello | upper`, "HELLO\n"},
+		{`echo hello | upper | tr H J`, "JELLO\n"},
+		{`printf 'b\na\n' | sort | upper`, "A\nB\n"},
+		{`yes | head -n 2 | upper`, "Y\nY\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if _, err := shell.handle(shell.ctx, test.line); err != nil {
+			t.Errorf("%s: %v", test.line, err)
+		}
+		if out.String() != test.out {
+			t.Errorf("%s: got %q, want %q", test.line, out.String(), test.out)
+		}
+	}
+}
+
+func TestShellPipelineStatus(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	if _, err := shell.handle(shell.ctx, "nosuchcommand | upper"); err != nil {
+		t.Error("pipeline status should come from its last stage:", err)
+	}
+	if _, err := shell.handle(shell.ctx, "echo hi | nosuchcommand"); err == nil {
+		t.Error("expected the last stage to fail")
+	}
+	if _, err := parse("echo hi |"); err == nil {
+		t.Error("expected a syntax error for a missing pipeline stage")
+	}
+}
+
+// runLines runs each line on shell and returns the output
+func runLines(t *testing.T, shell *Goshell, out *syncBuffer, lines ...string) string {
+	ctx := shell.ctx
+	for _, line := range lines {
+		var err error
+		if ctx, err = shell.handle(ctx, line); err != nil {
+			t.Errorf("%s: %v", line, err)
+		}
+	}
+	return out.String()
+}
+
+// scriptTest is a script with the output and exit status it should give
+type scriptTest struct {
+	script string
+	out    string
+	status int
+}
+
+// runScripts runs each script on a new test shell, after setup when it
+// isn't nil, and checks its output and exit status
+func runScripts(t *testing.T, tests []scriptTest, setup func(*Goshell)) {
+	t.Helper()
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if setup != nil {
+			setup(shell)
+		}
+		status := shell.Run(strings.NewReader(test.script))
+		if got := out.String(); got != test.out || status != test.status {
+			t.Errorf("%q: got %q with status %d, want %q with status %d",
+				test.script, got, status, test.out, test.status)
+		}
+	}
+}
+
+func TestShellLists(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{`args a; args b`, "[a]\n[b]\n"},
+		{`X=1; args $X;`, "[1]\n"},
+		{`true && args yes`, "[yes]\n"},
+		{`false && args yes`, ""},
+		{`false || args no`, "[no]\n"},
+		{`true || args no`, ""},
+		{`false && args a || args b`, "[b]\n"},
+		{`true && args a || args b`, "[a]\n"},
+		{"args a\nargs b\n\nargs c", "[a]\n[b]\n[c]\n"},
+		{"true &&\n args next", "[next]\n"},
+		{`nosuchcommand; args after`, "[after]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		shell.handle(context.WithValue(shell.ctx, "gosh.stderr", io.Discard), test.line)
+		if got := out.String(); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.out)
+		}
+	}
+
+	for _, line := range []string{`; args`, `args &&`, `args || ; args`, `&& args`} {
+		if _, err := parse(line); err == nil {
+			t.Errorf("%q: expected a syntax error", line)
+		}
+	}
+}
+
+func TestShellExitStatus(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{`true; args $?`, "[0]\n"},
+		{`false; args $?`, "[1]\n"},
+		{`sh -c 'exit 42'; args $?`, "[42]\n"},
+		{`nosuchcommand; args $?`, "command not found: nosuchcommand\n[127]\n"},
+		{`false | true; args $?`, "[0]\n"},
+		{`true | false; args $?`, "[1]\n"},
+		{`sh -c 'kill -TERM $$'; args $?`, "[143]\n"},
+		{`X=$(sh -c 'exit 3'); args $?`, "[3]\n"},
+		{`false; args $? $?`, "[1][1]\n"},
+		{`false || args $?`, "[1]\n"},
+		{`shopt -q dotglob; args $?`, "[1]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		shell.handle(shell.ctx, test.line)
+		if got := out.String(); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.out)
+		}
+	}
+
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	_, err := shell.handle(shell.ctx, `sh -c 'exit 5'`)
+	if api.Status(err) != 5 || shell.Status() != 5 {
+		t.Errorf("got status %d (%v), want 5", shell.Status(), err)
+	}
+}
+
+func TestShellRun(t *testing.T) {
+	tests := []scriptTest{
+		{"#!/usr/bin/env gosh\n# comment\nargs $0 $# # trailing\n", "[test.gosh][2]\n", 0},
+		{`args "$@"; args $@; args "$*"`, "[a b][c]\n[a][b][c]\n[a b c]\n", 0},
+		{"args $1\nshift\nargs $1 $#\nshift 5", "[a][b]\n[c][1]\n", 1},
+		{"args \\\n  joined", "[joined]\n", 0},
+		{"upper <<EOF\nfrom $2\nEOF\nfalse", "FROM C\n", 1},
+		{"args one\nargs 'two\nargs three", "[one]\nsyntax error: unterminated single quote: unexpected end of input\n", 2},
+		{"args one\nargs )\nargs three", "[one]\nsyntax error near unexpected token `)'\n", 2},
+		{"args '#' a#b", "[#][a#b]\n", 0},
+		{"args one; exit 3; args two", "[one]\n", 3},
+		{"false\nexit", "", 1},
+		{"x=$(args in; exit 4); args $? \"$x\"", "[4][[in]]\n", 0},
+		{"exit nope; args $?", "exit: nope: numeric argument required\n[1]\n", 0},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.name, shell.params = "test.gosh", []string{"a b", "c"}
+	})
+}
@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// expandWords expands the words of a command into the fields passed to the
+// command as its arguments: braces and tildes are expanded, parameters are
+// substituted, the unquoted results are split on $IFS, fields with unquoted
+// pattern characters are replaced by the matching filenames and quotes are
+// removed
+func (gosh *Goshell) expandWords(ctx context.Context, words []word) ([]string, error) {
+	fields := make([]string, 0, len(words))
+	for _, w := range words {
+		for _, bw := range expandBraces(w) {
+			wordFields, err := gosh.expandWord(ctx, gosh.expandTilde(bw, false))
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, wordFields...)
+		}
+	}
+	return fields, nil
+}
+
+// expandWord expands a single word into zero or more fields
+func (gosh *Goshell) expandWord(ctx context.Context, w word) ([]string, error) {
+	fb := &fieldBuilder{ifs: gosh.ifs()}
+	for _, part := range w {
+		// "$@" and "${NAME[@]}" expand to one field per element
+		if param, ok := part.(paramPart); ok && param.quoted && param.listOf() == "@" && !param.length && (param.op == "" || isTrimOp(param.op)) {
+			values, err := gosh.paramList(ctx, param)
+			if err != nil {
+				return nil, err
+			}
+			for i, value := range values {
+				if i > 0 {
+					fb.end()
+				}
+				fb.add(value, true)
+			}
+			continue
+		}
+		switch part := part.(type) {
+		case litPart:
+			fb.add(part.text, part.quoted)
+		default:
+			value, err := gosh.expandPart(ctx, part)
+			if err != nil {
+				return nil, err
+			}
+			if isQuoted(part) {
+				fb.add(value, true)
+			} else {
+				fb.split(value)
+			}
+		}
+	}
+
+	var fields []string
+	for _, f := range fb.finish() {
+		if !hasGlob(f.pattern) {
+			fields = append(fields, f.text)
+			continue
+		}
+		if matches := gosh.glob(f.pattern); len(matches) > 0 {
+			fields = append(fields, matches...)
+			continue
+		}
+		switch {
+		case gosh.options["failglob"]:
+			return nil, fmt.Errorf("no match: %s", f.text)
+		case gosh.options["nullglob"]:
+			continue
+		}
+		fields = append(fields, f.text)
+	}
+	return fields, nil
+}
+
+// expandString expands a word into a single string without field
+// splitting, as done for the value of an assignment
+func (gosh *Goshell) expandString(ctx context.Context, w word) (string, error) {
+	var sb strings.Builder
+	for _, part := range w {
+		switch part := part.(type) {
+		case litPart:
+			sb.WriteString(part.text)
+		default:
+			value, err := gosh.expandPart(ctx, part)
+			if err != nil {
+				return "", err
+			}
+			sb.WriteString(value)
+		}
+	}
+	return sb.String(), nil
+}
+
+// expandPattern expands a word into a shell pattern, characters that were
+// quoted are escaped so that they only match themselves
+func (gosh *Goshell) expandPattern(ctx context.Context, w word) (string, error) {
+	var sb strings.Builder
+	for _, part := range w {
+		switch part := part.(type) {
+		case litPart:
+			if part.quoted {
+				sb.WriteString(escapeGlob(part.text))
+			} else {
+				sb.WriteString(part.text)
+			}
+		default:
+			value, err := gosh.expandPart(ctx, part)
+			if err != nil {
+				return "", err
+			}
+			if isQuoted(part) {
+				value = escapeGlob(value)
+			}
+			sb.WriteString(value)
+		}
+	}
+	return sb.String(), nil
+}
+
+// expandTilde replaces an unquoted ~ prefix with a home directory: ~ is
+// $HOME, ~user the home of user, ~+ is $PWD and ~- is $OLDPWD. In the value
+// of an assignment, a ~ following a : is expanded as well.
+func (gosh *Goshell) expandTilde(w word, assignment bool) word {
+	if len(w) == 0 {
+		return w
+	}
+	lit, ok := w[0].(litPart)
+	if !ok || lit.quoted || !strings.HasPrefix(lit.text, "~") {
+		return w
+	}
+
+	var expanded word
+	segments := []string{lit.text}
+	if assignment {
+		segments = strings.Split(lit.text, ":")
+	}
+	for i, seg := range segments {
+		if i > 0 {
+			expanded = append(expanded, litPart{text: ":"})
+		}
+		prefix, rest, slash := strings.Cut(seg, "/")
+		// the prefix must end the word or be followed by a slash
+		last := i == len(segments)-1
+		home, ok := "", false
+		if strings.HasPrefix(prefix, "~") && (slash || !last || len(w) == 1) {
+			home, ok = gosh.tildeDir(prefix[1:])
+		}
+		if !ok {
+			expanded = append(expanded, litPart{text: seg})
+			continue
+		}
+		expanded = append(expanded, litPart{text: home, quoted: true})
+		if slash {
+			expanded = append(expanded, litPart{text: "/" + rest})
+		}
+	}
+	return append(expanded, w[1:]...)
+}
+
+// tildeDir returns the directory a ~ prefix stands for
+func (gosh *Goshell) tildeDir(name string) (string, bool) {
+	switch name {
+	case "":
+		if home, ok := gosh.getVar("HOME"); ok {
+			return home, true
+		}
+		home, err := os.UserHomeDir()
+		return home, err == nil
+	case "+":
+		return gosh.getVar("PWD")
+	case "-":
+		return gosh.getVar("OLDPWD")
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+	return u.HomeDir, true
+}
+
+// expandPart returns the value of an expansion
+func (gosh *Goshell) expandPart(ctx context.Context, part wordPart) (string, error) {
+	switch part := part.(type) {
+	case paramPart:
+		return gosh.expandParam(ctx, part)
+	case cmdSubstPart:
+		return gosh.commandSubst(ctx, part.src)
+	case arithPart:
+		value, err := gosh.expandArith(ctx, part.expr)
+		return strconv.FormatInt(value, 10), err
+	}
+	return "", fmt.Errorf("unsupported word part %T", part)
+}
+
+// isQuoted reports whether a word part was quoted
+func isQuoted(part wordPart) bool {
+	switch part := part.(type) {
+	case litPart:
+		return part.quoted
+	case paramPart:
+		return part.quoted
+	case cmdSubstPart:
+		return part.quoted
+	case arithPart:
+		return part.quoted
+	}
+	return false
+}
+
+// commandSubst runs src in a subshell through the same path as a command
+// line, and returns what it wrote to gosh.stdout without trailing newlines
+func (gosh *Goshell) commandSubst(ctx context.Context, src string) (string, error) {
+	out := new(bytes.Buffer)
+	_, err := gosh.subshell().handle(context.WithValue(ctx, "gosh.stdout", out), src)
+	gosh.substStatus = api.Status(err)
+	if err != nil {
+		gosh.reportError(ctx, err)
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// lookupParam returns the value of a variable or special parameter
+func (gosh *Goshell) lookupParam(name string) (string, bool) {
+	switch name {
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "?":
+		return strconv.Itoa(gosh.status), true
+	case "0":
+		return gosh.name, true
+	case "#":
+		return strconv.Itoa(len(gosh.params)), true
+	case "@":
+		return strings.Join(gosh.params, " "), len(gosh.params) > 0
+	case "-":
+		return gosh.optionFlags(), true
+	case "*":
+		sep := ""
+		if ifs := gosh.ifs(); ifs != "" {
+			sep = ifs[:1]
+		}
+		return strings.Join(gosh.params, sep), len(gosh.params) > 0
+	}
+	if n, err := strconv.Atoi(name); err == nil {
+		if n < 1 || n > len(gosh.params) {
+			return "", false
+		}
+		return gosh.params[n-1], true
+	}
+	return gosh.getVar(name)
+}
+
+// listOf returns @ or * for the expansions of a list of values, $@ and $*
+// or ${NAME[@]} and ${NAME[*]}, and "" for a single value
+func (part paramPart) listOf() string {
+	if part.list == "" && part.index == nil && (part.name == "@" || part.name == "*") {
+		return part.name
+	}
+	return part.list
+}
+
+func isTrimOp(op string) bool {
+	return op == "#" || op == "##" || op == "%" || op == "%%"
+}
+
+// paramList returns the values of a list expansion, the positional
+// parameters or the elements of an array, trimmed by the # and %
+// operators
+func (gosh *Goshell) paramList(ctx context.Context, part paramPart) ([]string, error) {
+	values := gosh.params
+	if part.list != "" {
+		values = gosh.arrayValues(part.name, part.keys)
+	}
+	if isTrimOp(part.op) {
+		pattern, err := gosh.expandPattern(ctx, part.arg)
+		if err != nil {
+			return nil, err
+		}
+		trimmed := make([]string, len(values))
+		for i, value := range values {
+			trimmed[i] = trimPattern(value, pattern, part.op)
+		}
+		values = trimmed
+	}
+	return values, nil
+}
+
+// expandParam returns the value of a parameter expansion
+func (gosh *Goshell) expandParam(ctx context.Context, part paramPart) (string, error) {
+	var value string
+	var set bool
+	switch list := part.listOf(); {
+	case list != "":
+		values, err := gosh.paramList(ctx, part)
+		if err != nil {
+			return "", err
+		}
+		if part.length {
+			return strconv.Itoa(len(values)), nil
+		}
+		sep := " "
+		if ifs := gosh.ifs(); list == "*" {
+			sep = ifs[:min(len(ifs), 1)]
+		}
+		value, set = strings.Join(values, sep), len(values) > 0
+		if isTrimOp(part.op) {
+			return value, nil
+		}
+	case part.index != nil:
+		key, err := gosh.subscriptKey(ctx, part.name, part.index)
+		if err != nil {
+			return "", err
+		}
+		value, set = gosh.getElem(part.name, key)
+	default:
+		value, set = gosh.lookupParam(part.name)
+	}
+	if !set && gosh.options["nounset"] && part.listOf() == "" && !strings.ContainsAny(part.op, "-=?+") {
+		return "", unboundError(part.name)
+	}
+	if part.length {
+		return strconv.Itoa(utf8.RuneCountInString(value)), nil
+	}
+
+	// with a colon, the operators also treat an empty value as unset
+	unset := !set || (strings.HasPrefix(part.op, ":") && value == "")
+	switch part.op {
+	case "-", ":-":
+		if unset {
+			return gosh.expandString(ctx, part.arg)
+		}
+	case "=", ":=":
+		if unset {
+			if !isName(part.name) {
+				return "", fmt.Errorf("$%s: cannot assign in this way", part.name)
+			}
+			value, err := gosh.expandString(ctx, part.arg)
+			if err != nil {
+				return "", err
+			}
+			if part.index != nil {
+				key, err := gosh.subscriptKey(ctx, part.name, part.index)
+				if err != nil {
+					return "", err
+				}
+				gosh.setElem(part.name, key, value)
+				return value, nil
+			}
+			gosh.setVar(part.name, value)
+			return value, nil
+		}
+	case "?", ":?":
+		if unset {
+			msg, err := gosh.expandString(ctx, part.arg)
+			if err != nil {
+				return "", err
+			}
+			if msg == "" {
+				msg = "parameter null or not set"
+			}
+			return "", fmt.Errorf("%s: %s", part.name, msg)
+		}
+	case "+", ":+":
+		if unset {
+			return "", nil
+		}
+		return gosh.expandString(ctx, part.arg)
+	case "#", "##", "%", "%%":
+		pattern, err := gosh.expandPattern(ctx, part.arg)
+		if err != nil {
+			return "", err
+		}
+		return trimPattern(value, pattern, part.op), nil
+	}
+	return value, nil
+}
+
+// trimPattern removes the shortest (# and %) or longest (## and %%) prefix
+// or suffix of value matching pattern
+func trimPattern(value, pattern, op string) string {
+	runes := []rune(value)
+	n := len(runes)
+	switch op {
+	case "#":
+		for i := 0; i <= n; i++ {
+			if matchPattern(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "##":
+		for i := n; i >= 0; i-- {
+			if matchPattern(pattern, string(runes[:i])) {
+				return string(runes[i:])
+			}
+		}
+	case "%":
+		for i := n; i >= 0; i-- {
+			if matchPattern(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	case "%%":
+		for i := 0; i <= n; i++ {
+			if matchPattern(pattern, string(runes[i:])) {
+				return string(runes[:i])
+			}
+		}
+	}
+	return value
+}
+
+// field is an expanded word, pattern is the field's text with its quoted
+// pattern characters escaped
+type field struct {
+	text    string
+	pattern string
+}
+
+// fieldBuilder accumulates the fields a word expands to
+type fieldBuilder struct {
+	ifs    string
+	fields []field
+	cur    strings.Builder
+	pat    strings.Builder
+	// inField is set once the current field has content, or an empty
+	// quoted string which still makes a field
+	inField bool
+}
+
+func (fb *fieldBuilder) add(s string, quoted bool) {
+	fb.cur.WriteString(s)
+	if quoted {
+		fb.pat.WriteString(escapeGlob(s))
+	} else {
+		fb.pat.WriteString(s)
+	}
+	if s != "" || quoted {
+		fb.inField = true
+	}
+}
+
+// split adds the unquoted result of an expansion, breaking it into fields
+// on the characters of $IFS. Runs of IFS whitespace separate fields while
+// every other IFS character ends a field, even an empty one.
+func (fb *fieldBuilder) split(s string) {
+	isSpace := func(r rune) bool {
+		return (r == ' ' || r == '\t' || r == '\n') && strings.ContainsRune(fb.ifs, r)
+	}
+	for s != "" {
+		i := strings.IndexAny(s, fb.ifs)
+		if fb.ifs == "" || i < 0 {
+			fb.add(s, false)
+			return
+		}
+		fb.add(s[:i], false)
+		s = strings.TrimLeftFunc(s[i:], isSpace)
+		if r, size := utf8.DecodeRuneInString(s); s != "" && !isSpace(r) && strings.ContainsRune(fb.ifs, r) {
+			fb.inField = true
+			s = strings.TrimLeftFunc(s[size:], isSpace)
+		}
+		fb.end()
+	}
+}
+
+// end terminates the current field
+func (fb *fieldBuilder) end() {
+	if fb.inField {
+		fb.fields = append(fb.fields, field{text: fb.cur.String(), pattern: fb.pat.String()})
+	}
+	fb.cur.Reset()
+	fb.pat.Reset()
+	fb.inField = false
+}
+
+func (fb *fieldBuilder) finish() []field {
+	fb.end()
+	return fb.fields
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShellParamExpansion(t *testing.T) {
+	tests := []struct {
+		lines []string
+		out   string
+	}{
+		{[]string{`X=hello`, `args $X "$X" ${X}world '$X'`}, "[hello][hello][helloworld][$X]\n"},
+		{[]string{`X="a  b"`, `args $X "$X"`}, "[a][b][a  b]\n"},
+		{[]string{`args $UNSET "$UNSET" x$UNSET`}, "[][x]\n"},
+		{[]string{`args ${U:-def} ${U-def} "${U:-a b}"`}, "[def][def][a b]\n"},
+		{[]string{`E=`, `args ${E:-def} "${E-def}" ${E:+set} ${E+set}`}, "[def][][set]\n"},
+		{[]string{`args ${N:=assigned} $N`}, "[assigned][assigned]\n"},
+		{[]string{`X=hello`, `args ${#X} ${#U}`}, "[5][0]\n"},
+		{[]string{`F=/usr/local/lib.tar.gz`, `args ${F#*/} ${F##*/} ${F%.*} ${F%%.*}`}, "[usr/local/lib.tar.gz][lib.tar.gz][/usr/local/lib.tar][/usr/local/lib]\n"},
+		{[]string{`F='a*b*c'`, `args ${F#"a*"} ${F%\*c}`}, "[b*c][a*b]\n"},
+		{[]string{`F=main.go`, `args "${F%.*}" "${F#"m"*}" "${F%'.*'}"`}, "[main][ain.go][main.go]\n"},
+		{[]string{`IFS=:`, `P=a:b::c`, `args $P`}, "[a][b][][c]\n"},
+		{[]string{`X=1 Y=2`, `args $X$Y`}, "[12]\n"},
+		{[]string{`args $ "$" a$`}, "[$][$][a$]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if got := runLines(t, shell, out, test.lines...); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.lines, got, test.out)
+		}
+	}
+}
+
+func TestShellParamErrors(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	if _, err := shell.handle(shell.ctx, `args ${U:?is required}`); err == nil || err.Error() != "U: is required" {
+		t.Errorf("got %v, want U: is required", err)
+	}
+	if _, err := shell.handle(shell.ctx, `args ${U`); err == nil {
+		t.Error("expected a syntax error for an unterminated ${")
+	}
+}
+
+func TestShellAssignments(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	got := runLines(t, shell, out,
+		`GOSH_TEST=one sh -c 'echo $GOSH_TEST'`,
+		`sh -c 'echo ${GOSH_TEST:-unset}'`,
+		`GOSH_TEST=two`,
+		`sh -c 'echo ${GOSH_TEST:-unexported}'`,
+		`export GOSH_TEST`,
+		`sh -c 'echo $GOSH_TEST'`,
+		`unset GOSH_TEST`,
+		`args "$GOSH_TEST"`,
+	)
+	if want := "one\nunset\nunexported\ntwo\n[]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestShellCommandSubst(t *testing.T) {
+	tests := []struct {
+		lines []string
+		out   string
+	}{
+		{[]string{`args $(echo hello world) "$(echo hello world)"`}, "[hello][world][hello world]\n"},
+		{[]string{"args `echo one` \"`echo two three`\""}, "[one][two three]\n"},
+		{[]string{`args "$(printf 'a\n\n\n')"`}, "[a]\n"},
+		{[]string{`args $(echo $(echo nested) "$(echo deeper $(echo still))")`}, "[nested][deeper][still]\n"},
+		{[]string{"args `echo \\`echo inner\\``"}, "[inner]\n"},
+		{[]string{`X=$(echo a b | upper)`, `args "$X"`}, "[A B]\n"},
+		{[]string{`args pre$(echo mid)post`}, "[premidpost]\n"},
+		{[]string{`args $(X=sub) "$X"`}, "[]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if got := runLines(t, shell, out, test.lines...); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.lines, got, test.out)
+		}
+	}
+}
+
+func TestShellBraceExpansion(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{`args file.{go,md}`, "[file.go][file.md]\n"},
+		{`args {a,b}{1,2}`, "[a1][a2][b1][b2]\n"},
+		{`args x{a,{b,c}}y`, "[xay][xby][xcy]\n"},
+		{`args {1..5}`, "[1][2][3][4][5]\n"},
+		{`args {3..1} {01..03}`, "[3][2][1][01][02][03]\n"},
+		{`args {a..i..2} {0..10..5}`, "[a][c][e][g][i][0][5][10]\n"},
+		{`args {,x}y`, "[y][xy]\n"},
+		{`args "{a,b}" \{a,b} {a} {} {a..}`, "[{a,b}][{a,b}][{a}][{}][{a..}]\n"},
+		{`args {"$NOPE",b}-{"c d",e}`, "[-c d][-e][b-c d][b-e]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if got := runLines(t, shell, out, test.line); got != test.out {
+			t.Errorf("%s: got %q, want %q", test.line, got, test.out)
+		}
+	}
+}
+
+func TestShellTildeExpansion(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.setVar("HOME", "/home/gosh")
+	shell.setVar("PWD", "/work")
+	shell.setVar("OLDPWD", "/prev")
+	got := runLines(t, shell, out,
+		`args ~ ~/src "~/src" \~ ~+ ~-/x a~`,
+		`P=~/bin:~/sbin`,
+		`args "$P"`,
+	)
+	if want := "[/home/gosh][/home/gosh/src][~/src][~][/work][/prev/x][a~]\n[/home/gosh/bin:/home/gosh/sbin]\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
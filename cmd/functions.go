@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// funcDef defines a shell function, src is the text of the definition
+type funcDef struct {
+	name string
+	body node
+	src  string
+}
+
+// isFuncDef reports whether a name() function definition starts at the
+// current position
+func (p *parser) isFuncDef() bool {
+	start := p.pos
+	defer func() { p.pos = start }()
+	if !isFuncName(p.funcName()) {
+		return false
+	}
+	p.skipBlanks()
+	if p.peek() != '(' {
+		return false
+	}
+	p.pos++
+	p.skipBlanks()
+	return p.peek() == ')'
+}
+
+// funcName reads the unquoted word naming a function
+func (p *parser) funcName() string {
+	start := p.pos
+	for !p.eof() && !isMeta(p.peek()) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// isFuncName reports whether name can name a function, it must not need
+// quoting nor be mistaken for an assignment
+func isFuncName(name string) bool {
+	return name != "" && !reservedWords[name] && !strings.ContainsAny(name, "'\"\\$`=")
+}
+
+// funcDef parses function name [()] compound-command and name()
+// compound-command
+func (p *parser) funcDef() (node, error) {
+	start := p.pos
+	if p.keyword() == "function" {
+		p.pos += len("function")
+		p.skipBlanks()
+	}
+	nameStart := p.pos
+	def := &funcDef{name: p.funcName()}
+	if !isFuncName(def.name) {
+		p.pos = nameStart
+		return nil, p.unexpected()
+	}
+	if p.skipBlanks(); p.peek() == '(' {
+		p.pos++
+		if p.skipBlanks(); p.peek() != ')' {
+			return nil, p.unexpected()
+		}
+		p.pos++
+	}
+
+	if err := p.skipNewlines(); err != nil {
+		return nil, err
+	}
+	switch p.keyword() {
+	case "{", "if", "while", "until", "for", "case":
+	default:
+		return nil, p.unexpected()
+	}
+	body, err := p.command()
+	if err != nil {
+		return nil, err
+	}
+	def.body = body
+	def.src = string(p.src[start:p.pos])
+	return def, nil
+}
+
+// maxFuncNest is how deep function calls may nest, a function calling
+// itself endlessly fails instead of exhausting the stack
+const maxFuncNest = 1000
+
+// funcCmd is a shell function, registered in the command table like the
+// plugin commands. A function shadowing another command keeps it to put
+// it back when the function is unset.
+type funcCmd struct {
+	def      *funcDef
+	shadowed api.Command
+}
+
+func (f *funcCmd) Name() string      { return f.def.name }
+func (f *funcCmd) Usage() string     { return f.def.name + " [arg ...]" }
+func (f *funcCmd) ShortDesc() string { return `shell function` }
+func (f *funcCmd) LongDesc() string  { return f.def.src }
+func (f *funcCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(gosh.frames) >= maxFuncNest {
+		return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: maximum function nesting level exceeded (%d)", f.def.name, maxFuncNest)}
+	}
+
+	params, loopDepth := gosh.params, gosh.loopDepth
+	gosh.params, gosh.loopDepth = args[1:], 0
+	gosh.frames = append(gosh.frames, make(map[string]*variable))
+	defer func() {
+		frame := gosh.frames[len(gosh.frames)-1]
+		gosh.frames = gosh.frames[:len(gosh.frames)-1]
+		for name, v := range frame {
+			if v == nil {
+				delete(gosh.vars, name)
+				continue
+			}
+			gosh.vars[name] = v
+		}
+		gosh.params, gosh.loopDepth = params, loopDepth
+	}()
+
+	ctx, err = gosh.exec(ctx, f.def.body)
+	var ret funcReturn
+	if errors.As(err, &ret) {
+		if ret == 0 {
+			return ctx, nil
+		}
+		return ctx, api.ExitStatus(ret)
+	}
+	return ctx, err
+}
+
+// defineFunc registers a function in the command table
+func (gosh *Goshell) defineFunc(def *funcDef) {
+	f := &funcCmd{def: def, shadowed: gosh.commands[def.name]}
+	if prev, ok := f.shadowed.(*funcCmd); ok {
+		f.shadowed = prev.shadowed
+	}
+	gosh.commands[def.name] = f
+}
+
+// unsetFunc removes a function from the command table, it reports whether
+// name was a function
+func (gosh *Goshell) unsetFunc(name string) bool {
+	f, ok := gosh.commands[name].(*funcCmd)
+	if !ok {
+		return false
+	}
+	if f.shadowed != nil {
+		gosh.commands[name] = f.shadowed
+	} else {
+		delete(gosh.commands, name)
+	}
+	return true
+}
+
+// funcReturn is returned by the return command with the function's status
+type funcReturn int
+
+func (r funcReturn) Error() string { return "return " + strconv.Itoa(int(r)) }
+func (r funcReturn) ExitCode() int { return int(r) }
+
+// returnCmd returns from a function
+type returnCmd string
+
+func (c returnCmd) Name() string     { return string(c) }
+func (c returnCmd) Usage() string    { return "return [n]" }
+func (c returnCmd) LongDesc() string { return "" }
+func (c returnCmd) ShortDesc() string {
+	return `returns from a function with status n, or the status of the last command`
+}
+func (c returnCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(gosh.frames) == 0 && gosh.sourcing == 0 {
+		return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: can only `return' from a function or sourced file", c.Name())}
+	}
+	status := api.GetStatus(ctx)
+	if len(args) > 1 {
+		n, err := strconv.Atoi(args[1])
+		if err != nil {
+			return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %s: numeric argument required", c.Name(), args[1])}
+		}
+		status = n & 0xff
+	}
+	return ctx, funcReturn(status)
+}
+
+// localCmd creates variables that only live until the function returns
+type localCmd string
+
+func (c localCmd) Name() string     { return string(c) }
+func (c localCmd) Usage() string    { return "local [-aAx] name[=value] ..." }
+func (c localCmd) LongDesc() string { return "" }
+func (c localCmd) ShortDesc() string {
+	return `creates variables local to the running function`
+}
+func (c localCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(gosh.frames) == 0 {
+		return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: can only be used in a function", c.Name())}
+	}
+	// in a function, declare creates local variables
+	return declareCmd(c).Exec(ctx, args)
+}
+
+// localVar makes a variable local to the running function, the variable
+// it hides comes back when the function returns
+func (gosh *Goshell) localVar(name string) {
+	frame := gosh.frames[len(gosh.frames)-1]
+	if _, saved := frame[name]; !saved {
+		frame[name] = gosh.vars[name]
+		delete(gosh.vars, name)
+	}
+}
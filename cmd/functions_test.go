@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestShellFunctions(t *testing.T) {
+	tests := []scriptTest{
+		{"greet() { args hello \"$@\" $#; }; greet a 'b c'", "[hello][a][b c][2]\n", 0},
+		{"function greet { args $1; }\ngreet x; args $1", "[x]\n[one]\n", 0},
+		{"function greet() {\n  args multi\n  args line\n}\ngreet", "[multi]\n[line]\n", 0},
+		{"f() { return 3; args never; }; f; args $?", "[3]\n", 0},
+		{"f() { false; return; }; f; args $?", "[1]\n", 0},
+		{"f() { for x in a b c; do if [ $x = b ]; then return 4; fi; args $x; done; }; f; args $?", "[a]\n[4]\n", 0},
+		{"f() { local X=inner Y; Y=set; args $X $Y; }; X=outer; f; args $X ${Y-unset}", "[inner][set]\n[outer][unset]\n", 0},
+		{"f() { G=global; }; f; args $G", "[global]\n", 0},
+		{"inner() { args $X; }; outer() { local X=dynamic; inner; }; outer", "[dynamic]\n", 0},
+		{"f() { args in-f; }; f | upper", "[IN-F]\n", 0},
+		{"f() { args redirected; } > /dev/null; f; args after", "[after]\n", 0},
+		{"upper() { args shadowed; }; upper; unset -f upper; args x | upper", "[shadowed]\n[X]\n", 0},
+		{"f() { args one; }; f() { args two; }; f", "[two]\n", 0},
+		{"f() if true; then args compound; fi; f", "[compound]\n", 0},
+		{"f() { break; }; for x in a b; do args $x; f; done", "[a]\nbreak: only meaningful in a `for', `while', or `until' loop\n[b]\nbreak: only meaningful in a `for', `while', or `until' loop\n", 0},
+		{"return 2", "return: can only `return' from a function or sourced file\n", 1},
+		{"local X=1", "local: can only be used in a function\n", 1},
+		{"f() { args $#; shift; }; f a b; args $#", "[2]\n[2]\n", 0},
+		{"f() { f; }; f; args $?", "f: maximum function nesting level exceeded (1000)\n[1]\n", 0},
+		{"n=0; f() { n=$((n+1)); [ $n -lt 999 ] && f; }; f; args $n", "[999]\n", 0},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.params = []string{"one", "two"}
+	})
+}
+
+func TestShellFunctionRegistry(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	runLines(t, shell, out, "greet() { args hi; }")
+	cmd, ok := shell.commands["greet"]
+	if !ok {
+		t.Fatal("function not registered as a command")
+	}
+	if cmd.Name() != "greet" || cmd.LongDesc() != "greet() { args hi; }" {
+		t.Errorf("got name %q and description %q", cmd.Name(), cmd.LongDesc())
+	}
+	runLines(t, shell, out, "unset -f greet")
+	if _, ok := shell.commands["greet"]; ok {
+		t.Error("unset -f left the function registered")
+	}
+
+	for _, line := range []string{"f() {\n", "function f\n", "f() {\n  args\n"} {
+		if _, err := parse(line); !errors.Is(err, errIncomplete) {
+			t.Errorf("%q: got %v, want an incomplete input error", line, err)
+		}
+	}
+	if _, err := parse("f() args;"); err == nil {
+		t.Error("expected a syntax error for a function without a compound body")
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// hasGlob reports whether pattern contains unescaped pattern characters, a
+// [ only counts when it is closed
+func hasGlob(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '*', '?':
+			return true
+		case '[':
+			if i+2 < len(pattern) && strings.Contains(pattern[i+2:], "]") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// unescapeGlob removes the backslashes escaping pattern characters
+func unescapeGlob(pattern string) string {
+	if !strings.Contains(pattern, `\`) {
+		return pattern
+	}
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		sb.WriteByte(pattern[i])
+	}
+	return sb.String()
+}
+
+// glob returns the sorted paths matching pattern. Each path component is
+// matched on its own, so * never matches a '/', except for a ** component
+// which matches any number of directories. Names starting with a dot are
+// only matched by a pattern starting with a dot unless dotglob is set.
+func (gosh *Goshell) glob(pattern string) []string {
+	dotglob := gosh.options["dotglob"]
+	components := strings.Split(pattern, "/")
+	paths := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		paths = []string{"/"}
+		components = components[1:]
+	}
+
+	for i, comp := range components {
+		last := i == len(components)-1
+		var next []string
+		switch {
+		case comp == "" && last:
+			// a trailing slash only matches directories
+			for _, p := range paths {
+				if isDir(p) {
+					next = append(next, p+"/")
+				}
+			}
+		case comp == "":
+			next = paths
+		case comp == "**":
+			for _, p := range paths {
+				next = append(next, walkDirs(p, dotglob, last)...)
+			}
+		case !hasGlob(comp):
+			name := unescapeGlob(comp)
+			for _, p := range paths {
+				candidate := joinPath(p, name)
+				if _, err := os.Lstat(candidate); err == nil {
+					next = append(next, candidate)
+				}
+			}
+		default:
+			hidden := dotglob || strings.HasPrefix(comp, ".")
+			for _, p := range paths {
+				dir := p
+				if dir == "" {
+					dir = "."
+				}
+				entries, err := os.ReadDir(dir)
+				if err != nil {
+					continue
+				}
+				for _, entry := range entries {
+					name := entry.Name()
+					if strings.HasPrefix(name, ".") && !hidden {
+						continue
+					}
+					if matchPattern(comp, name) {
+						next = append(next, joinPath(p, name))
+					}
+				}
+			}
+		}
+		paths = next
+		if len(paths) == 0 {
+			return nil
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// walkDirs returns dir and all the directories below it for a ** pattern,
+// or every file below it when ** ends the pattern. Symbolic links are not
+// followed.
+func walkDirs(dir string, dotglob, files bool) []string {
+	var paths []string
+	if dir != "" || !files {
+		paths = append(paths, dir)
+	}
+	root := dir
+	if root == "" {
+		root = "."
+	}
+	filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") && !dotglob {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || files {
+			if dir == "" {
+				path = strings.TrimPrefix(path, "./")
+			}
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	return paths
+}
+
+func joinPath(dir, name string) string {
+	switch {
+	case dir == "":
+		return name
+	case strings.HasSuffix(dir, "/"):
+		return dir + name
+	}
+	return dir + "/" + name
+}
+
+func isDir(path string) bool {
+	if path == "" {
+		path = "."
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShellGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.go", "a.go", "c.md", ".hidden.go", "src/x.go", "src/deep/y.go", "src/.git/z.go"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		lines []string
+		out   string
+	}{
+		{[]string{`args *.go`}, "[a.go][b.go]\n"},
+		{[]string{`args ?.md [ab].go`}, "[c.md][a.go][b.go]\n"},
+		{[]string{`args "*.go" '*'.go \*.go`}, "[*.go][*.go][*.go]\n"},
+		{[]string{`args .*.go`}, "[.hidden.go]\n"},
+		{[]string{`args */`}, "[src/]\n"},
+		{[]string{`args src/*/*.go`}, "[src/deep/y.go]\n"},
+		{[]string{`args **/*.go`}, "[a.go][b.go][src/deep/y.go][src/x.go]\n"},
+		{[]string{`args src/**`}, "[src][src/deep][src/deep/y.go][src/x.go]\n"},
+		{[]string{`P='*.md'`, `args $P "$P"`}, "[c.md][*.md]\n"},
+		{[]string{`args *.txt`}, "[*.txt]\n"},
+		{[]string{`shopt -s nullglob`, `args *.txt`}, "\n"},
+		{[]string{`shopt -s dotglob`, `args *.go`}, "[.hidden.go][a.go][b.go]\n"},
+		{[]string{`args [ x ]`}, "[[][x][]]\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if got := runLines(t, shell, out, test.lines...); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.lines, got, test.out)
+		}
+	}
+
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	runLines(t, shell, out, `shopt -s failglob`)
+	if _, err := shell.handle(shell.ctx, `args *.txt`); err == nil {
+		t.Error("expected an error with failglob set")
+	}
+}
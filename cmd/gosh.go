@@ -4,11 +4,12 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"os/exec"
-	"os/signal"
 	"path"
 	"plugin"
 	"regexp"
@@ -18,24 +19,114 @@ import (
 	"github.com/donrudo/gosh/api"
 )
 
-var (
-	reCmd = regexp.MustCompile(`\S+`)
-)
-
 type Goshell struct {
 	ctx        context.Context
 	pluginsDir string
 	commands   map[string]api.Command
-	closed     chan struct{}
+	// builtins are the commands of the shell itself, which plugins may
+	// replace, pluginFiles maps the plugin commands to the file they were
+	// loaded from and hash remembers where programs were found in $PATH
+	builtins    map[string]api.Command
+	pluginFiles map[string]string
+	hash        *pathCache
+	vars        map[string]*variable
+	options     map[string]bool
+	status      int
+	// name and params are $0 and the positional parameters $1, $2...
+	name   string
+	params []string
+	// aliases maps alias names to the text replacing them
+	aliases map[string]string
+	// sourcing is the number of files being read by source
+	sourcing int
+	// loopDepth is the number of loops running, for break and continue
+	loopDepth int
+	// frames hold the variables that local shadows in each running
+	// function, restored when it returns
+	frames []map[string]*variable
+	// substStatus is the status of the last command substitution
+	substStatus int
+	// condDepth is the number of conditions running, whose failures don't
+	// stop the shell with set -e
+	condDepth int
+	// interactive is set when commands are read from the prompt
+	interactive bool
+	// traps are the commands run on signals, EXIT and ERR, notify receives
+	// the signals caught, passed on to sigs once the foreground has been
+	// interrupted, and trapping is set while a handler runs
+	traps    map[string]string
+	notify   chan os.Signal
+	sigs     chan os.Signal
+	trapping bool
+	// tty is the terminal of an interactive session with job control, fg
+	// the commands it runs in the foreground, job the job a subshell runs
+	tty    *os.File
+	fg     *foreground
+	jobs   *jobTable
+	job    *job
+	closed chan struct{}
 }
 
 // New returns a new shell
 func New() *Goshell {
-	return &Goshell{
-		pluginsDir: api.PluginsDir,
-		commands:   make(map[string]api.Command),
-		closed:     make(chan struct{}),
+	gosh := &Goshell{
+		pluginsDir:  api.PluginsDir,
+		commands:    builtinCommands(),
+		builtins:    builtinCommands(),
+		pluginFiles: make(map[string]string),
+		hash:        &pathCache{},
+		vars:        loadEnviron(),
+		options:     make(map[string]bool),
+		aliases:     make(map[string]string),
+		traps:       make(map[string]string),
+		fg:          newForeground(true),
+		jobs:        &jobTable{},
+		name:        "gosh",
+		closed:      make(chan struct{}),
+	}
+	if wd, err := os.Getwd(); err == nil {
+		gosh.setVar("PWD", wd)
+	}
+	return gosh
+}
+
+// subshell returns a copy of the shell for commands that must not change
+// the session, such as the stages of a pipeline
+func (gosh *Goshell) subshell() *Goshell {
+	sub := *gosh
+	sub.commands = make(map[string]api.Command, len(gosh.commands))
+	for name, cmd := range gosh.commands {
+		sub.commands[name] = cmd
+	}
+	sub.vars = make(map[string]*variable, len(gosh.vars))
+	for name, v := range gosh.vars {
+		sub.vars[name] = v.clone()
+	}
+	sub.options = make(map[string]bool, len(gosh.options))
+	for name, on := range gosh.options {
+		sub.options[name] = on
+	}
+	sub.aliases = make(map[string]string, len(gosh.aliases))
+	for name, value := range gosh.aliases {
+		sub.aliases[name] = value
+	}
+	// signals are handled by the session, a subshell only keeps the
+	// signals it ignores
+	sub.notify, sub.sigs = nil, nil
+	sub.traps = make(map[string]string)
+	for name, cmd := range gosh.traps {
+		if cmd == "" {
+			sub.traps[name] = cmd
+		}
+	}
+	sub.frames = make([]map[string]*variable, len(gosh.frames))
+	for i, frame := range gosh.frames {
+		sub.frames[i] = make(map[string]*variable, len(frame))
+		for name, v := range frame {
+			sub.frames[i][name] = v
+		}
 	}
+	return &sub
 }
 
 // Init initializes the shell with the given context
@@ -47,6 +138,7 @@ func (gosh *Goshell) Init(ctx context.Context) error {
 	if pluginsDir := os.Getenv("GOSH_PLUGINS_DIR"); pluginsDir != "" {
 		gosh.pluginsDir = pluginsDir
 	}
+	gosh.ctx = context.WithValue(gosh.ctx, "gosh.commands", gosh.commands)
 
 	return gosh.loadCommands()
 }
@@ -65,8 +157,15 @@ func (gosh *Goshell) loadCommands() error {
 		return err
 	}
 
+	// plugins announce themselves as they load, which only the interactive
+	// session shows
+	initCtx := gosh.ctx
+	if !gosh.interactive {
+		initCtx = context.WithValue(initCtx, "gosh.stdout", io.Discard)
+	}
 	for _, cmdPlugin := range plugins {
-		plug, err := plugin.Open(path.Join(gosh.pluginsDir, cmdPlugin.Name()))
+		file := path.Join(gosh.pluginsDir, cmdPlugin.Name())
+		plug, err := plugin.Open(file)
 		if err != nil {
 			fmt.Printf("failed to open plugin %s: %v\n", cmdPlugin.Name(), err)
 			continue
@@ -83,90 +182,213 @@ func (gosh *Goshell) loadCommands() error {
 				api.CmdSymbolName, cmdPlugin.Name())
 			continue
 		}
-		if err := commands.Init(gosh.ctx); err != nil {
+		if err := commands.Init(initCtx); err != nil {
 			fmt.Printf("%s initialization failed: %v\n", cmdPlugin.Name(), err)
 			continue
 		}
 		for name, cmd := range commands.Registry() {
 			gosh.commands[name] = cmd
+			gosh.pluginFiles[name] = file
 		}
 		gosh.ctx = context.WithValue(gosh.ctx, "gosh.commands", gosh.commands)
+		initCtx = context.WithValue(initCtx, "gosh.commands", gosh.commands)
 	}
 	return nil
 }
 
 // Open opens the shell for the given reader
 func (gosh *Goshell) Open(r *bufio.Reader) {
+	gosh.interactive = true
 	loopCtx := gosh.ctx
 	line := make(chan string)
+	reading := false
+	// pending holds the lines of a command that is not complete yet, such
+	// as a here-document waiting for its delimiter
+	pending := ""
 	for {
-		// start a goroutine to get input from the user
-		go func(ctx context.Context, input chan<- string) {
-			for {
-				// TODO: future enhancement is to capture input key by key
-				// to give command granular notification of key events.
-				// This could be used to implement command autocompletion.
-				fmt.Fprintf(ctx.Value("gosh.stdout").(io.Writer), "%s ", api.GetPrompt(loopCtx))
-				line, err := r.ReadString('\n')
-				if err != nil {
-					fmt.Fprintf(ctx.Value("gosh.stderr").(io.Writer), "%v\n", err)
-					continue
-				}
+		prompt := api.GetPrompt(loopCtx)
+		if pending != "" {
+			prompt = gosh.continuationPrompt()
+		}
+		// start a goroutine to get input from the user, unless one is
+		// still waiting for it after a signal
+		if !reading {
+			gosh.jobs.notify(api.GetStderr(loopCtx))
+			reading = true
+			go func(ctx context.Context, input chan<- string) {
+				for {
+					// TODO: future enhancement is to capture input key by key
+					// to give command granular notification of key events.
+					// This could be used to implement command autocompletion.
+					fmt.Fprintf(ctx.Value("gosh.stdout").(io.Writer), "%s ", prompt)
+					line, err := r.ReadString('\n')
+					// an empty line tells the input has ended, a last line
+					// without a newline is ended first
+					if err == io.EOF && line != "" {
+						line += "\n"
+					} else if err == io.EOF {
+						fmt.Fprintln(ctx.Value("gosh.stdout").(io.Writer))
+					} else if err != nil {
+						fmt.Fprintf(ctx.Value("gosh.stderr").(io.Writer), "%v\n", err)
+						continue
+					}
 
-				input <- line
-				return
-			}
-		}(loopCtx, line)
+					input <- line
+					return
+				}
+			}(loopCtx, line)
+		}
 
-		// wait for input or cancel
+		// wait for input, a signal or cancel
 		select {
 		case <-gosh.ctx.Done():
-			close(gosh.closed)
+			gosh.close(loopCtx)
 			return
+		case sig := <-gosh.sigs:
+			if err := gosh.signaled(loopCtx, sig); isExit(err) {
+				gosh.status = api.Status(err)
+				gosh.close(loopCtx)
+				return
+			}
+			// Ctrl+C drops the line being typed and prompts again
+			if sig == syscall.SIGINT {
+				pending = ""
+				gosh.status = 128 + int(syscall.SIGINT)
+				fmt.Fprintf(api.GetStdout(loopCtx), "\n%s ", api.GetPrompt(loopCtx))
+			}
 		case input := <-line:
+			reading = false
+			if input == "" {
+				gosh.close(loopCtx)
+				return
+			}
+			pending += input
+			if strings.HasSuffix(pending, "\\\n") {
+				continue
+			}
 			var err error
-			loopCtx, err = gosh.handle(loopCtx, input)
+			gosh.fg.reset()
+			loopCtx, err = gosh.handle(loopCtx, pending)
+			if errors.Is(err, errIncomplete) {
+				continue
+			}
+			pending = ""
+			if isExit(err) {
+				gosh.close(loopCtx)
+				return
+			}
+			// the prompt goes on a new line after the ^C of an interrupted
+			// command
+			if s := gosh.status; s == 128+int(syscall.SIGINT) || s == 128+int(syscall.SIGQUIT) {
+				fmt.Fprintln(api.GetStdout(loopCtx))
+			}
 			if err != nil {
-				fmt.Fprintf(loopCtx.Value("gosh.stderr").(io.Writer), "%v\n", err)
+				gosh.reportError(loopCtx, err)
 			}
 		}
 	}
 }
 
+// close ends the interactive session, after running the EXIT trap
+func (gosh *Goshell) close(ctx context.Context) {
+	gosh.status = gosh.exitTrap(ctx, gosh.status)
+	close(gosh.closed)
+}
+
+// continuationPrompt returns the prompt shown while reading the rest of an
+// incomplete command, taken from $PS2
+func (gosh *Goshell) continuationPrompt() string {
+	if ps2, ok := gosh.getVar("PS2"); ok {
+		return strings.TrimSuffix(ps2, " ")
+	}
+	return ">"
+}
+
+// Run runs the commands read from r, as for a script, until its end or an
+// exit command and returns the exit status of the session. A syntax error
+// stops the script.
+func (gosh *Goshell) Run(r io.Reader) int {
+	_, err := gosh.run(gosh.ctx, r)
+	if err != nil && !isExit(err) {
+		gosh.reportError(gosh.ctx, err)
+	}
+	return gosh.exitTrap(gosh.ctx, api.Status(err))
+}
+
+// run runs the commands read from r in the session, each one as soon as it
+// is complete, and returns the context left by the last one. Errors of the
+// commands are reported as they run, the error returned stops reading, such
+// as an exit or a syntax error, or only carries the last status.
+func (gosh *Goshell) run(ctx context.Context, r io.Reader) (context.Context, error) {
+	br := bufio.NewReader(r)
+	pending := ""
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return ctx, err
+		}
+		eof := err == io.EOF
+		pending += line
+		if !eof && strings.HasSuffix(pending, "\\\n") {
+			continue
+		}
+
+		ctx, err = gosh.handle(ctx, pending)
+		if errors.Is(err, errIncomplete) && !eof {
+			continue
+		}
+		pending = ""
+		if unwinds(err) || errors.As(err, new(syntaxError)) {
+			return ctx, err
+		}
+		if err != nil {
+			gosh.reportError(ctx, err)
+		}
+		if eof {
+			if gosh.status != 0 {
+				return ctx, api.ExitStatus(gosh.status)
+			}
+			return ctx, nil
+		}
+	}
+}
+
 // Closed returns a channel that closes when the shell has closed
 func (gosh *Goshell) Closed() <-chan struct{} {
 	return gosh.closed
 }
 
+// Status returns the exit status of the last command run by the shell
+func (gosh *Goshell) Status() int {
+	return gosh.status
+}
+
 func (gosh *Goshell) handle(ctx context.Context, cmdLine string) (context.Context, error) {
-	line := strings.TrimSpace(cmdLine)
-	if line == "" {
+	if strings.TrimSpace(cmdLine) == "" {
 		return ctx, nil
 	}
-	args := reCmd.FindAllString(line, -1)
-	if args != nil {
-		cmdName := args[0]
-		cmd, ok := gosh.commands[cmdName]
-		if !ok {
-			err := externalExec(ctx, cmdName, args)
-			if err != nil {
-				return ctx, errors.New(fmt.Sprintf("command not found: %s", cmdName))
-			}
-			//return ctx, errors.New(fmt.Sprintf("command not found: %s", cmdName))
-			return ctx, nil
+	p := &parser{src: []rune(cmdLine), aliases: gosh.aliases}
+	tree, err := p.parse()
+	if err != nil {
+		if !errors.Is(err, errIncomplete) {
+			gosh.status = 2
 		}
-		return cmd.Exec(ctx, args)
+		return ctx, syntaxError{err}
+	}
+	// set -n only checks the syntax of scripts
+	if tree == nil || (gosh.options["noexec"] && !gosh.interactive) {
+		return ctx, nil
 	}
-	return ctx, errors.New(fmt.Sprintf("unable to parse command line: %s", line))
+	return gosh.exec(ctx, tree)
 }
 
-func listFiles(dir, pattern string) ([]os.FileInfo, error) {
+func listFiles(dir, pattern string) ([]os.DirEntry, error) {
 	files, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, err
 	}
 
-	filteredFiles := []os.FileInfo{}
+	filteredFiles := []os.DirEntry{}
 	for _, file := range files {
 		if file.IsDir() {
 			continue
@@ -176,13 +398,23 @@ func listFiles(dir, pattern string) ([]os.FileInfo, error) {
 			return nil, err
 		}
 		if matched {
-			filteredFiles = append(filteredFiles)
+			filteredFiles = append(filteredFiles, file)
 		}
 	}
 	return filteredFiles, nil
 }
 
 func main() {
+	command := flag.String("c", "", "runs `command` and exits, the remaining arguments set $0, $1...")
+	forceInteractive := flag.Bool("i", false, "prompts for commands even when stdin is not a terminal")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gosh [-i] [-c command [name [arg ...]]] [script [arg ...]]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	commandSet := false
+	flag.Visit(func(f *flag.Flag) { commandSet = commandSet || f.Name == "c" })
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -191,11 +423,37 @@ func main() {
 	ctx = context.WithValue(ctx, "gosh.stderr", os.Stderr)
 	ctx = context.WithValue(ctx, "gosh.stdin", os.Stdin)
 
+	// commands are read from the prompt when stdin is a terminal, a command
+	// or a script, or commands piped to gosh, run without it
+	args := flag.Args()
 	shell := New()
+	shell.interactive = *forceInteractive ||
+		(!commandSet && len(args) == 0 && isTerminal(os.Stdin))
 	if err := shell.Init(ctx); err != nil {
 		fmt.Println("\n\nfailed to initialize:\n", err)
 		os.Exit(1)
 	}
+	if shell.interactive && isTerminal(os.Stdin) {
+		shell.startJobControl(os.Stdin)
+	}
+	shell.catchSignals()
+
+	// the plugin commands of the jobs left are cancelled on exit
+	exit := func(status int) {
+		shell.shutdown()
+		os.Exit(status)
+	}
+	switch {
+	case commandSet:
+		if len(args) > 0 {
+			shell.name, shell.params = args[0], args[1:]
+		}
+		exit(shell.Run(strings.NewReader(*command)))
+	case len(args) > 0:
+		exit(shell.runScript(args[0], args[1:]))
+	case !shell.interactive:
+		exit(shell.Run(os.Stdin))
+	}
 
 	// prompt for help
 	cmdCount := len(shell.commands)
@@ -210,27 +468,50 @@ func main() {
 	}
 
 	go shell.Open(bufio.NewReader(os.Stdin))
+	<-shell.Closed()
+	exit(shell.Status())
+}
 
-	sigs := make(chan os.Signal)
-	signal.Notify(sigs, syscall.SIGINT)
-	select {
-	case <-sigs:
-		cancel()
-		<-shell.Closed()
-	case <-shell.Closed():
+// runScript runs the script at path with args as its positional
+// parameters, the script's own path is $0
+func (gosh *Goshell) runScript(path string, args []string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		gosh.reportError(gosh.ctx, err)
+		if errors.Is(err, fs.ErrNotExist) {
+			return 127
+		}
+		return 126
 	}
+	defer f.Close()
+	gosh.name, gosh.params = path, args
+	return gosh.Run(f)
 }
 
-func externalExec(ctx context.Context, command string, arg []string) error {
-	cmd := exec.Command(command)
-	cmd.Args = arg
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
+func (gosh *Goshell) externalExec(ctx context.Context, command string, arg []string) error {
+	file, err := gosh.lookPath(command)
 	if err != nil {
-		fmt.Sprintf("command not found: %s", command)
-		return errors.New(fmt.Sprintf("error using: %s", command))
+		return statusError{status: 127, msg: fmt.Sprintf("command not found: %s", command)}
 	}
-	return nil
+	cmd := exec.Command(file)
+	cmd.Args = arg
+	cmd.Env = gosh.environ()
+	cmd.Stdin = api.GetStdin(ctx)
+	cmd.Stdout = api.GetStdout(ctx)
+	cmd.Stderr = api.GetStderr(ctx)
+	pg, release, err := gosh.startProcess(ctx, cmd)
+	if err == nil {
+		defer release()
+		// timeout signals the program once its context is done
+		if sig, ok := ctx.Value("gosh.timeout").(syscall.Signal); ok {
+			stop := context.AfterFunc(ctx, func() { _ = cmd.Process.Signal(sig) })
+			defer stop()
+		}
+		// a command that ran reports its own errors, only its status is kept
+		return gosh.waitProcess(cmd, pg)
+	}
+	if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+		return statusError{status: 127, msg: fmt.Sprintf("command not found: %s", command)}
+	}
+	return statusError{status: 126, msg: fmt.Sprintf("%s: %v", command, err)}
 }
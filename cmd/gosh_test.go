@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"io"
 	"os"
 	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -71,3 +74,51 @@ func TestShellHandle(t *testing.T) {
 	}
 
 }
+
+func TestShellCd(t *testing.T) {
+	shell := New()
+	shell.pluginsDir = testPluginsDir
+	ctx := context.WithValue(context.TODO(), "gosh.stdout", io.Discard)
+	if err := shell.Init(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := shell.commands["cd"]; !ok {
+		t.Fatal("missing 'cd' command from dir module")
+	}
+
+	out := new(syncBuffer)
+	shell.ctx = context.WithValue(shell.ctx, "gosh.stdout", out)
+	shell.ctx = context.WithValue(shell.ctx, "gosh.stderr", out)
+	status := shell.Run(strings.NewReader("cd /nonexistent && echo x || echo failed"))
+	want := "cd: /nonexistent: no such file or directory\nfailed\n"
+	if got := out.String(); got != want || status != 0 {
+		t.Errorf("got %q with status %d, want %q with status 0", got, status, want)
+	}
+}
+
+func TestShellOpenEOF(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.ctx = context.WithValue(shell.ctx, "gosh.prompt", ">")
+	go shell.Open(bufio.NewReader(strings.NewReader("args one\nfalse")))
+	select {
+	case <-shell.Closed():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shell didn't close at the end of its input")
+	}
+	if got, want := out.String(), "> [one]\n> > \n"; got != want || shell.Status() != 1 {
+		t.Errorf("got %q with status %d, want %q with status 1", got, shell.Status(), want)
+	}
+}
+
+func TestIsTerminal(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	if isTerminal(r) {
+		t.Error("a pipe is not a terminal")
+	}
+}
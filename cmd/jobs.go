@@ -0,0 +1,806 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// jobState is the state of a job in the job table
+type jobState int
+
+const (
+	jobRunning jobState = iota
+	jobStopped
+	jobDone
+)
+
+// job is a command run in the background with &. Its plugin commands and
+// process groups are kept in its own foreground, so that it can be signaled
+// and brought to the foreground as a whole.
+type job struct {
+	id     int
+	text   string
+	fg     *foreground
+	pg     *procGroup
+	state  jobState
+	status int
+	done   chan struct{}
+	// stopped receives when the job stops, procs is the number of
+	// processes of a job stopped in the foreground still running
+	stopped chan struct{}
+	procs   int
+}
+
+// jobTable holds the jobs of a session, in the order they were started or
+// stopped: the last one is the current job %+, the one before it %-
+type jobTable struct {
+	mu   sync.Mutex
+	jobs []*job
+}
+
+// add creates a running job, numbered after the highest job number in use
+func (jt *jobTable) add(text string) *job {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	return jt.newJob(text)
+}
+
+// newJob is add with jt.mu held
+func (jt *jobTable) newJob(text string) *job {
+	j := &job{
+		id:      1,
+		text:    text,
+		fg:      newForeground(false),
+		pg:      &procGroup{},
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}, 1),
+	}
+	for _, other := range jt.jobs {
+		if other.id >= j.id {
+			j.id = other.id + 1
+		}
+	}
+	jt.jobs = append(jt.jobs, j)
+	return j
+}
+
+// finish records the status a job ended with
+func (jt *jobTable) finish(j *job, status int) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	j.state, j.status = jobDone, status
+	close(j.done)
+}
+
+// setState changes the state of a job, a stopped job becomes the current one
+func (jt *jobTable) setState(j *job, state jobState) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	if j.state == jobDone {
+		return
+	}
+	j.state = state
+	if state == jobStopped {
+		jt.moveLast(j)
+		select {
+		case j.stopped <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stop makes the processes of a pipeline stopped in the foreground a
+// stopped job named after the pipeline, the stages of a pipeline join the
+// job of the first one
+func (jt *jobTable) stop(pg *procGroup) *job {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	j := jt.ofGroup(pg)
+	if j == nil {
+		j = jt.newJob(pg.text)
+		j.pg = pg
+		j.fg.addGroup(pg.id())
+		j.state = jobStopped
+	}
+	j.procs++
+	return j
+}
+
+// ofGroup returns the job the process group pg became when stopped in the
+// foreground, nil if it didn't, with jt.mu held
+func (jt *jobTable) ofGroup(pg *procGroup) *job {
+	for _, j := range jt.jobs {
+		if j.pg == pg && j.state != jobDone {
+			return j
+		}
+	}
+	return nil
+}
+
+// stopped returns the job the process group pg became when stopped in
+// the foreground, nil if it didn't
+func (jt *jobTable) stopped(pg *procGroup) *job {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	return jt.ofGroup(pg)
+}
+
+// exited records the end of a process of a job stopped in the foreground,
+// the job ends with its last process
+func (jt *jobTable) exited(j *job, status int) {
+	jt.mu.Lock()
+	j.procs--
+	last := j.procs == 0
+	jt.mu.Unlock()
+	if last {
+		jt.finish(j, status)
+	}
+}
+
+// moveLast makes j the current job
+func (jt *jobTable) moveLast(j *job) {
+	for i, other := range jt.jobs {
+		if other == j {
+			jt.jobs = append(append(jt.jobs[:i:i], jt.jobs[i+1:]...), j)
+			return
+		}
+	}
+}
+
+// remove takes a job out of the table, it keeps running if it hasn't ended
+func (jt *jobTable) remove(j *job) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	for i, other := range jt.jobs {
+		if other == j {
+			jt.jobs = append(jt.jobs[:i], jt.jobs[i+1:]...)
+			return
+		}
+	}
+}
+
+// find returns the job of a job spec: %n, %+ or %% for the current job, %-
+// for the previous one, %name for the job whose command starts with name
+// and %?text for the one containing text. An empty spec is the current job.
+func (jt *jobTable) find(spec string) (*job, error) {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	last := func(back int) (*job, error) {
+		if len(jt.jobs) <= back {
+			return nil, fmt.Errorf("%s: no such job", spec)
+		}
+		return jt.jobs[len(jt.jobs)-1-back], nil
+	}
+	switch spec {
+	case "", "%", "%%", "%+":
+		if len(jt.jobs) == 0 {
+			return nil, errors.New("no current job")
+		}
+		return last(0)
+	case "%-":
+		return last(1)
+	}
+	if !strings.HasPrefix(spec, "%") {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	if n, err := strconv.Atoi(spec[1:]); err == nil {
+		for _, j := range jt.jobs {
+			if j.id == n {
+				return j, nil
+			}
+		}
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+
+	var found *job
+	for _, j := range jt.jobs {
+		text, ok := strings.CutPrefix(spec, "%?")
+		matches := ok && strings.Contains(j.text, text)
+		if !ok {
+			matches = strings.HasPrefix(j.text, spec[1:])
+		}
+		if !matches {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("%s: ambiguous job spec", spec)
+		}
+		found = j
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%s: no such job", spec)
+	}
+	return found, nil
+}
+
+// list returns the jobs in the order of their numbers
+func (jt *jobTable) list() []*job {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	jobs := append([]*job{}, jt.jobs...)
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].id < jobs[b].id })
+	return jobs
+}
+
+// describe returns the line jobs prints for a job
+func (jt *jobTable) describe(j *job, long bool) string {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+	mark := ' '
+	switch {
+	case len(jt.jobs) > 0 && jt.jobs[len(jt.jobs)-1] == j:
+		mark = '+'
+	case len(jt.jobs) > 1 && jt.jobs[len(jt.jobs)-2] == j:
+		mark = '-'
+	}
+	state, text := "", j.text
+	switch {
+	case j.state == jobRunning:
+		state, text = "Running", text+" &"
+	case j.state == jobStopped:
+		state = "Stopped"
+	case j.status == 0:
+		state = "Done"
+	default:
+		state = fmt.Sprintf("Exit %d", j.status)
+	}
+	pid := ""
+	if long {
+		pid = "-     "
+		if pgid := j.pg.id(); pgid != 0 {
+			pid = fmt.Sprintf("%-6d", pgid)
+		}
+	}
+	return fmt.Sprintf("[%d]%c  %s%-24s%s", j.id, mark, pid, state, text)
+}
+
+// notify prints the jobs that have ended since the last prompt and takes
+// them out of the table
+func (jt *jobTable) notify(w io.Writer) {
+	for _, j := range jt.list() {
+		select {
+		case <-j.done:
+			fmt.Fprintln(w, jt.describe(j, false))
+			jt.remove(j)
+		default:
+		}
+	}
+}
+
+// execBackground starts a command as a job and returns without waiting for
+// it. The job runs in a subshell, its external commands in a process group
+// of their own that doesn't get the terminal.
+func (gosh *Goshell) execBackground(ctx context.Context, bg *backgroundCmd) (context.Context, error) {
+	j := gosh.jobs.add(bg.text)
+	sub := gosh.subshell()
+	sub.fg, sub.job = j.fg, j
+	jobCtx := context.WithValue(ctx, "gosh.pgroup", j.pg)
+	// without job control, a job doesn't read the input of the shell
+	var devNull *os.File
+	if gosh.tty == nil {
+		if f, err := os.Open(os.DevNull); err == nil {
+			devNull = f
+			jobCtx = context.WithValue(jobCtx, "gosh.stdin", f)
+		}
+	}
+
+	go func() {
+		_, err := sub.exec(jobCtx, bg.cmd)
+		if err != nil && !unwinds(err) {
+			sub.reportError(jobCtx, err)
+		}
+		if devNull != nil {
+			devNull.Close()
+		}
+		sub.releaseGroup(j.pg)
+		gosh.jobs.finish(j, api.Status(err))
+	}()
+	if gosh.interactive {
+		fmt.Fprintf(api.GetStderr(ctx), "[%d]\n", j.id)
+	}
+	return ctx, nil
+}
+
+// errShellExit is the cause of the cancellation of the plugin commands of
+// the jobs left when the shell exits
+var errShellExit = errors.New("shell exited")
+
+// shutdown cancels the plugin commands of the jobs left as the shell exits
+// and waits at most cancelGrace for them to return. Their external commands,
+// and disowned jobs, run on.
+func (gosh *Goshell) shutdown() {
+	grace := time.NewTimer(cancelGrace)
+	defer grace.Stop()
+	jobs := gosh.jobs.list()
+	idle := make([]<-chan struct{}, len(jobs))
+	for i, j := range jobs {
+		idle[i] = j.fg.end(errShellExit)
+	}
+	for _, returned := range idle {
+		select {
+		case <-returned:
+		case <-grace.C:
+			return
+		}
+	}
+}
+
+// waitProcess waits for an external command of the process group pg to end
+// and returns its status. With job control, a command stopped in the
+// foreground becomes a stopped job that is waited for in the background,
+// the shell going on with the next command. A command stopped in a job
+// stops the job.
+func (gosh *Goshell) waitProcess(cmd *exec.Cmd, pg *procGroup) error {
+	if gosh.job != nil {
+		return gosh.waitJobProcess(cmd, gosh.job)
+	}
+	ws, err := waitStatus(cmd.Process.Pid)
+	for err == nil && ws.Stopped() {
+		if gosh.tty != nil && pg != nil {
+			j := gosh.jobs.stop(pg)
+			go func() {
+				gosh.jobs.exited(j, api.Status(gosh.waitJobProcess(cmd, j)))
+			}()
+			return api.ExitStatus(128 + int(ws.StopSignal()))
+		}
+		ws, err = waitStatus(cmd.Process.Pid)
+	}
+	err = processStatus(cmd, ws, err)
+	// with job control, Ctrl+C only reaches the foreground process group,
+	// the shell interrupts the rest of the command line
+	if sig := ws.Signal(); gosh.tty != nil && ws.Signaled() && (sig == syscall.SIGINT || sig == syscall.SIGQUIT) {
+		gosh.fg.signal(sig)
+	}
+	return err
+}
+
+// reportStopped prints the job that the commands of the process group pg
+// became when stopped in the foreground, once they all returned
+func (gosh *Goshell) reportStopped(ctx context.Context, pg *procGroup) {
+	if j := gosh.jobs.stopped(pg); j != nil {
+		fmt.Fprintf(api.GetStderr(ctx), "\n%s\n", gosh.jobs.describe(j, false))
+	}
+}
+
+// waitJobProcess waits for an external command of a job to end, the job
+// is stopped while the command is
+func (gosh *Goshell) waitJobProcess(cmd *exec.Cmd, j *job) error {
+	ws, err := waitStatus(cmd.Process.Pid)
+	for err == nil && ws.Stopped() {
+		gosh.jobs.setState(j, jobStopped)
+		ws, err = waitStatus(cmd.Process.Pid)
+	}
+	return processStatus(cmd, ws, err)
+}
+
+// processStatus returns the status of an ended process
+func processStatus(cmd *exec.Cmd, ws syscall.WaitStatus, err error) error {
+	// the process is reaped already, Wait only closes its streams
+	_ = cmd.Wait()
+	switch {
+	case err != nil:
+		return err
+	case ws.Signaled():
+		return api.ExitStatus(128 + int(ws.Signal()))
+	case ws.ExitStatus() != 0:
+		return api.ExitStatus(ws.ExitStatus())
+	}
+	return nil
+}
+
+// waitStatus waits for a process to stop or end
+func waitStatus(pid int) (syscall.WaitStatus, error) {
+	var ws syscall.WaitStatus
+	for {
+		_, err := syscall.Wait4(pid, &ws, syscall.WUNTRACED, nil)
+		if err != syscall.EINTR {
+			return ws, err
+		}
+	}
+}
+
+// signalJob sends sig to a job, a job that is stopped or continued
+// changes state
+func (gosh *Goshell) signalJob(j *job, sig syscall.Signal) {
+	j.fg.signal(sig)
+	switch sig {
+	case syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU:
+		gosh.jobs.setState(j, jobStopped)
+	case syscall.SIGCONT:
+		gosh.jobs.setState(j, jobRunning)
+	}
+}
+
+// waitJob waits for a job to end and takes it out of the table. A signal
+// interrupting the wait is returned as an error.
+func (gosh *Goshell) waitJob(ctx context.Context, j *job) (int, error) {
+	select {
+	case <-j.done:
+	case <-ctx.Done():
+		return 0, context.Cause(ctx)
+	}
+	gosh.jobs.remove(j)
+	return j.status, nil
+}
+
+// waitForeground waits for a job brought to the foreground to end or to
+// stop again, Ctrl+C reaching its plugin commands through the shell
+func (gosh *Goshell) waitForeground(ctx context.Context, j *job) error {
+	for {
+		select {
+		case <-j.done:
+			gosh.jobs.remove(j)
+			if j.status != 0 {
+				return api.ExitStatus(j.status)
+			}
+			return nil
+		case <-j.stopped:
+			fmt.Fprintf(api.GetStderr(ctx), "\n%s\n", gosh.jobs.describe(j, false))
+			return api.ExitStatus(128 + int(syscall.SIGTSTP))
+		case <-ctx.Done():
+			var intr interrupted
+			if errors.As(context.Cause(ctx), &intr) {
+				j.fg.signal(intr.sig)
+			}
+			ctx = context.WithoutCancel(ctx)
+		}
+	}
+}
+
+// jobArgs returns the jobs named by the job specs of a builtin, or the
+// current job when there are none
+func (gosh *Goshell) jobArgs(name string, specs []string) ([]*job, error) {
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	jobs := make([]*job, 0, len(specs))
+	for _, spec := range specs {
+		j, err := gosh.jobs.find(spec)
+		if err != nil {
+			return nil, statusError{status: 1, msg: fmt.Sprintf("%s: %v", name, err)}
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// jobsCmd lists the jobs of the session
+type jobsCmd string
+
+func (c jobsCmd) Name() string  { return string(c) }
+func (c jobsCmd) Usage() string { return "jobs [-lp] [%job ...]" }
+func (c jobsCmd) LongDesc() string {
+	return `  -l    also prints the process group of each job
+  -p    only prints the process groups
+Jobs are named %1, %2..., %% or %+ is the current job and %- the previous
+one, %name is the job whose command starts with name.
+`
+}
+func (c jobsCmd) ShortDesc() string {
+	return `lists the jobs started with & and their state`
+}
+func (c jobsCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	long, pids := false, false
+	args = args[1:]
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'l':
+				long = true
+			case 'p':
+				pids = true
+			default:
+				return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %s: invalid option\nusage: %s", c.Name(), args[0], c.Usage())}
+			}
+		}
+		args = args[1:]
+	}
+
+	jobs := gosh.jobs.list()
+	if len(args) > 0 {
+		if jobs, err = gosh.jobArgs(c.Name(), args); err != nil {
+			return ctx, err
+		}
+	}
+	out := api.GetStdout(ctx)
+	for _, j := range jobs {
+		if pids {
+			if pgid := j.pg.id(); pgid != 0 {
+				fmt.Fprintln(out, pgid)
+			}
+			continue
+		}
+		fmt.Fprintln(out, gosh.jobs.describe(j, long))
+		select {
+		case <-j.done:
+			gosh.jobs.remove(j)
+		default:
+		}
+	}
+	return ctx, nil
+}
+
+// fgCmd brings a job to the foreground and waits for it
+type fgCmd string
+
+func (c fgCmd) Name() string     { return string(c) }
+func (c fgCmd) Usage() string    { return "fg [%job]" }
+func (c fgCmd) LongDesc() string { return "" }
+func (c fgCmd) ShortDesc() string {
+	return `brings a job to the foreground, continuing it if stopped`
+}
+func (c fgCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	jobs, err := gosh.jobArgs(c.Name(), args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	j := jobs[0]
+	fmt.Fprintln(api.GetStdout(ctx), j.text)
+
+	// the process groups of the job get the terminal and Ctrl+C
+	j.fg.mu.Lock()
+	j.fg.terminal = true
+	for pgid := range j.fg.groups {
+		if gosh.tty != nil {
+			_ = setForegroundGroup(gosh.tty, pgid)
+		}
+	}
+	j.fg.mu.Unlock()
+	defer func() {
+		j.fg.mu.Lock()
+		j.fg.terminal = false
+		j.fg.mu.Unlock()
+		if gosh.tty != nil {
+			_ = setForegroundGroup(gosh.tty, syscall.Getpgrp())
+		}
+	}()
+	select {
+	case <-j.stopped:
+	default:
+	}
+	gosh.signalJob(j, syscall.SIGCONT)
+	return ctx, gosh.waitForeground(ctx, j)
+}
+
+// bgCmd continues stopped jobs in the background
+type bgCmd string
+
+func (c bgCmd) Name() string     { return string(c) }
+func (c bgCmd) Usage() string    { return "bg [%job ...]" }
+func (c bgCmd) LongDesc() string { return "" }
+func (c bgCmd) ShortDesc() string {
+	return `continues stopped jobs in the background`
+}
+func (c bgCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	jobs, err := gosh.jobArgs(c.Name(), args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	for _, j := range jobs {
+		gosh.jobs.mu.Lock()
+		state := j.state
+		gosh.jobs.mu.Unlock()
+		if state != jobStopped {
+			fmt.Fprintf(api.GetStderr(ctx), "%s: job %d already in background\n", c.Name(), j.id)
+			continue
+		}
+		gosh.signalJob(j, syscall.SIGCONT)
+		fmt.Fprintf(api.GetStdout(ctx), "[%d] %s &\n", j.id, j.text)
+	}
+	return ctx, nil
+}
+
+// waitCmd waits for jobs to end
+type waitCmd string
+
+func (c waitCmd) Name() string  { return string(c) }
+func (c waitCmd) Usage() string { return "wait [%job | pid ...]" }
+func (c waitCmd) LongDesc() string {
+	return `Without arguments, waits for all the jobs and returns 0. Otherwise the
+status is the status of the last job waited for, 127 if it doesn't exist.
+`
+}
+func (c waitCmd) ShortDesc() string {
+	return `waits for jobs to end and returns their status`
+}
+func (c waitCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	if len(args) < 2 {
+		for _, j := range gosh.jobs.list() {
+			if _, err := gosh.waitJob(ctx, j); err != nil {
+				return ctx, err
+			}
+		}
+		return ctx, nil
+	}
+
+	var result error
+	for _, spec := range args[1:] {
+		j, err := gosh.jobs.find(spec)
+		if pid, perr := strconv.Atoi(spec); perr == nil {
+			j, err = nil, fmt.Errorf("pid %d is not a child of this shell", pid)
+			for _, other := range gosh.jobs.list() {
+				if other.pg.id() == pid {
+					j, err = other, nil
+				}
+			}
+		}
+		if err != nil {
+			result = statusError{status: 127, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+			continue
+		}
+		status, err := gosh.waitJob(ctx, j)
+		if err != nil {
+			return ctx, err
+		}
+		result = nil
+		if status != 0 {
+			result = api.ExitStatus(status)
+		}
+	}
+	return ctx, result
+}
+
+// disownCmd takes jobs out of the job table, leaving them running
+type disownCmd string
+
+func (c disownCmd) Name() string     { return string(c) }
+func (c disownCmd) Usage() string    { return "disown [-a] [%job ...]" }
+func (c disownCmd) LongDesc() string { return "  -a    disowns all the jobs\n" }
+func (c disownCmd) ShortDesc() string {
+	return `forgets jobs, which keep running but are no longer listed`
+}
+func (c disownCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	jobs := gosh.jobs.list()
+	if len(args) < 2 || args[1] != "-a" {
+		if jobs, err = gosh.jobArgs(c.Name(), args[1:]); err != nil {
+			return ctx, err
+		}
+	}
+	for _, j := range jobs {
+		gosh.jobs.remove(j)
+	}
+	return ctx, nil
+}
+
+// killSignals are the signals kill knows by name
+var killSignals = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"QUIT", syscall.SIGQUIT},
+	{"KILL", syscall.SIGKILL},
+	{"USR1", syscall.SIGUSR1},
+	{"USR2", syscall.SIGUSR2},
+	{"PIPE", syscall.SIGPIPE},
+	{"ALRM", syscall.SIGALRM},
+	{"TERM", syscall.SIGTERM},
+	{"CHLD", syscall.SIGCHLD},
+	{"CONT", syscall.SIGCONT},
+	{"STOP", syscall.SIGSTOP},
+	{"TSTP", syscall.SIGTSTP},
+	{"TTIN", syscall.SIGTTIN},
+	{"TTOU", syscall.SIGTTOU},
+	{"WINCH", syscall.SIGWINCH},
+}
+
+// killSignal returns the signal named by spec, with or without the SIG
+// prefix, or numbered by it
+func killSignal(spec string) (syscall.Signal, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		return syscall.Signal(n), n >= 0 && n < 65
+	}
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	for _, ks := range killSignals {
+		if ks.name == name {
+			return ks.sig, true
+		}
+	}
+	return 0, false
+}
+
+// killCmd sends a signal to processes and jobs
+type killCmd string
+
+func (c killCmd) Name() string  { return string(c) }
+func (c killCmd) Usage() string { return "kill [-s signal | -signal] pid | %job ... or kill -l" }
+func (c killCmd) LongDesc() string {
+	return `  kill %1            terminates job 1, with SIGTERM
+  kill -9 1234       kills process 1234
+  kill -s STOP %2    stops job 2, bg or fg continues it
+  kill -l            lists the signal names
+A job of plugin commands sees its context cancelled.
+`
+}
+func (c killCmd) ShortDesc() string {
+	return `sends a signal to processes or jobs, SIGTERM by default`
+}
+func (c killCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	args = args[1:]
+	sig := syscall.SIGTERM
+	if len(args) > 0 && args[0] == "-l" {
+		for _, ks := range killSignals {
+			fmt.Fprintf(api.GetStdout(ctx), "%2d) SIG%s\n", ks.sig, ks.name)
+		}
+		return ctx, nil
+	}
+	if len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && args[0] != "--" {
+		spec := args[0][1:]
+		args = args[1:]
+		if spec == "s" || spec == "n" {
+			if len(args) == 0 {
+				return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: -%s: option requires an argument\nusage: %s", c.Name(), spec, c.Usage())}
+			}
+			spec, args = args[0], args[1:]
+		}
+		var ok bool
+		if sig, ok = killSignal(spec); !ok {
+			return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %s: invalid signal specification", c.Name(), spec)}
+		}
+	}
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ctx, statusError{status: 2, msg: fmt.Sprintf("usage: %s", c.Usage())}
+	}
+
+	var result error
+	for _, target := range args {
+		if strings.HasPrefix(target, "%") {
+			j, err := gosh.jobs.find(target)
+			if err != nil {
+				result = statusError{status: 1, msg: fmt.Sprintf("%s: %v", c.Name(), err)}
+				continue
+			}
+			gosh.signalJob(j, sig)
+			continue
+		}
+		pid, err := strconv.Atoi(target)
+		if err != nil {
+			result = statusError{status: 1, msg: fmt.Sprintf("%s: %s: arguments must be process or job IDs", c.Name(), target)}
+			continue
+		}
+		if err := syscall.Kill(pid, sig); err != nil {
+			result = statusError{status: 1, msg: fmt.Sprintf("%s: (%d) - %v", c.Name(), pid, err)}
+		}
+	}
+	return ctx, result
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShellJobs(t *testing.T) {
+	tests := []scriptTest{
+		{"sh -c 'sleep 0.2; echo bg' & args fg; jobs; wait; args $?; jobs", "[fg]\n[1]+  Running                 sh -c 'sleep 0.2; echo bg' &\nbg\n[0]\n", 0},
+		{"sh -c 'exit 3' & wait %1; args $?", "[3]\n", 0},
+		{"sh -c 'exit 3' & wait; args $?", "[0]\n", 0},
+		{"sleep 5 & sleep 6 & jobs %+ %-; kill %1 %2; wait %1; args $?; wait %sleep; args $?", "[2]+  Running                 sleep 6 &\n[1]-  Running                 sleep 5 &\n[143]\n[143]\n", 0},
+		{"{ sleep 5; args after; } & kill -INT %1; wait %1; args $?", "[130]\n", 0},
+		{"block & kill -s HUP %%; wait; args $?; jobs", "[0]\n", 0},
+		{"block & block & jobs -p; jobs %?lock", "jobs: %?lock: ambiguous job spec\n", 1},
+		{"args a & wait; args b", "[a]\n[b]\n", 0},
+		{"sh -c 'kill -STOP $$; echo resumed' & sleep 0.5; jobs; bg; jobs; wait %1; args $?", "[1]+  Stopped                 sh -c 'kill -STOP $$; echo resumed'\n[1] sh -c 'kill -STOP $$; echo resumed' &\n[1]+  Running                 sh -c 'kill -STOP $$; echo resumed' &\nresumed\n[0]\n", 0},
+		{"sleep 5 & kill -STOP %1; jobs; bg %1 %1; kill %1; wait; jobs", "[1]+  Stopped                 sleep 5\n[1] sleep 5 &\nbg: job 1 already in background\n", 0},
+		{"upper & wait", "", 0},
+		// a stage may find the group it joins ended and lead a new one
+		{"for i in $(seq 300); do true | /bin/echo -n .; done & wait", strings.Repeat(".", 300), 0},
+		{"nosuch & wait %1", "command not found: nosuch\n", 127},
+		{"sleep 5 & disown; jobs; wait %1", "wait: %1: no such job\n", 127},
+		{"fg", "fg: no current job\n", 1},
+		{"bg %2", "bg: %2: no such job\n", 1},
+		{"kill %1", "kill: %1: no such job\n", 1},
+		{"kill -s FOO 1", "kill: FOO: invalid signal specification\n", 1},
+		{"kill abc", "kill: abc: arguments must be process or job IDs\n", 1},
+		{"& args", "syntax error near unexpected token `&'\n", 2},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.commands["block"] = blockCmd("block")
+	})
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// pathCache remembers where programs were found in $PATH, the hash table
+// of the session. It is shared with subshells and forgotten when $PATH
+// changes.
+type pathCache struct {
+	mu sync.Mutex
+	// path is the $PATH the programs were found in
+	path    string
+	entries map[string]*hashEntry
+}
+
+// hashEntry is a program found in $PATH and the number of times it ran
+type hashEntry struct {
+	file string
+	hits int
+}
+
+// isExecutable reports whether file is a program the shell can run
+func isExecutable(file string) bool {
+	info, err := os.Stat(file)
+	return err == nil && info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// searchPath returns the programs named name in the directories of
+// pathList, only the first one unless all is set. An empty directory is
+// the working directory.
+func searchPath(pathList, name string, all bool) []string {
+	var found []string
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			dir = "."
+		}
+		file := filepath.Join(dir, name)
+		if !strings.Contains(file, "/") {
+			file = "./" + file
+		}
+		if isExecutable(file) {
+			found = append(found, file)
+			if !all {
+				break
+			}
+		}
+	}
+	return found
+}
+
+// find returns where the program name is in pathList, from the table or
+// else searching for it. hit counts a run of the program.
+func (pc *pathCache) find(pathList, name string, hit bool) (string, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.entries == nil || pc.path != pathList {
+		pc.path, pc.entries = pathList, make(map[string]*hashEntry)
+	}
+	// a program removed since is searched for again
+	e, ok := pc.entries[name]
+	if !ok || !isExecutable(e.file) {
+		found := searchPath(pathList, name, false)
+		if len(found) == 0 {
+			delete(pc.entries, name)
+			return "", false
+		}
+		e = &hashEntry{file: found[0]}
+		pc.entries[name] = e
+	}
+	if hit {
+		e.hits++
+	}
+	return e.file, true
+}
+
+// cached returns where the program name was found, if it is in the table
+func (pc *pathCache) cached(pathList, name string) (string, bool) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	e, ok := pc.entries[name]
+	if !ok || pc.path != pathList {
+		return "", false
+	}
+	return e.file, true
+}
+
+// forget takes a program out of the table, it reports whether it was in it
+func (pc *pathCache) forget(name string) bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	_, ok := pc.entries[name]
+	delete(pc.entries, name)
+	return ok
+}
+
+// reset empties the table
+func (pc *pathCache) reset() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.entries = nil
+}
+
+// list returns the programs in the table by name
+func (pc *pathCache) list() []hashEntry {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	names := make([]string, 0, len(pc.entries))
+	for name := range pc.entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	entries := make([]hashEntry, len(names))
+	for i, name := range names {
+		entries[i] = *pc.entries[name]
+	}
+	return entries
+}
+
+// lookPath returns the file of the program name runs, names with a slash
+// are paths already
+func (gosh *Goshell) lookPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		return name, nil
+	}
+	pathList, _ := gosh.getVar("PATH")
+	if file, ok := gosh.hash.find(pathList, name, true); ok {
+		return file, nil
+	}
+	return "", errors.New(name + ": not found")
+}
+
+// commandKind is what a command name stands for: an alias, function,
+// builtin, plugin or program file. value is the text of an alias, the file
+// of a plugin or program.
+type commandKind struct {
+	kind  string
+	value string
+}
+
+// resolve returns what name stands for, in the order the shell looks for
+// it, only the command that runs unless all is set
+func (gosh *Goshell) resolve(name string, all bool) []commandKind {
+	var kinds []commandKind
+	if value, ok := gosh.aliases[name]; ok {
+		kinds = append(kinds, commandKind{"alias", value})
+	}
+	cmd := gosh.commands[name]
+	for {
+		f, ok := cmd.(*funcCmd)
+		if !ok {
+			break
+		}
+		kinds = append(kinds, commandKind{"function", f.def.src})
+		cmd = f.shadowed
+	}
+	if file, ok := gosh.pluginFiles[name]; ok && cmd != nil {
+		kinds = append(kinds, commandKind{"plugin", file})
+		cmd = gosh.builtins[name]
+	}
+	if cmd != nil {
+		kinds = append(kinds, commandKind{"builtin", ""})
+	}
+	pathList, _ := gosh.getVar("PATH")
+	switch {
+	case strings.Contains(name, "/"):
+		if isExecutable(name) {
+			kinds = append(kinds, commandKind{"file", name})
+		}
+	case all:
+		for _, file := range searchPath(pathList, name, true) {
+			kinds = append(kinds, commandKind{"file", file})
+		}
+	case len(kinds) == 0:
+		// the program that runs is the one remembered, if any
+		if file, ok := gosh.hash.cached(pathList, name); ok && isExecutable(file) {
+			kinds = append(kinds, commandKind{"file", file})
+		} else if found := searchPath(pathList, name, false); len(found) > 0 {
+			kinds = append(kinds, commandKind{"file", found[0]})
+		}
+	}
+	if !all && len(kinds) > 1 {
+		kinds = kinds[:1]
+	}
+	return kinds
+}
+
+// describe returns how type tells what name stands for
+func (gosh *Goshell) describe(name string, k commandKind) string {
+	switch k.kind {
+	case "alias":
+		return fmt.Sprintf("%s is aliased to `%s'", name, k.value)
+	case "function":
+		return fmt.Sprintf("%s is a function\n%s", name, strings.TrimRight(k.value, "\n"))
+	case "plugin":
+		return fmt.Sprintf("%s is a plugin command from %s", name, k.value)
+	case "builtin":
+		return fmt.Sprintf("%s is a shell builtin", name)
+	}
+	pathList, _ := gosh.getVar("PATH")
+	if file, ok := gosh.hash.cached(pathList, name); ok && file == k.value {
+		return fmt.Sprintf("%s is hashed (%s)", name, k.value)
+	}
+	return fmt.Sprintf("%s is %s", name, k.value)
+}
+
+// commandFlags reads the single letter flags of a command among allowed,
+// it returns the flags set and the arguments left
+func commandFlags(name, usage, allowed string, args []string) (map[rune]bool, []string, error) {
+	flags := make(map[rune]bool)
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		for _, flag := range arg[1:] {
+			if !strings.ContainsRune(allowed, flag) {
+				return nil, nil, statusError{status: 2, msg: fmt.Sprintf("%s: -%c: invalid option\nusage: %s", name, flag, usage)}
+			}
+			flags[flag] = true
+		}
+	}
+	return flags, args, nil
+}
+
+// typeCmd tells what command names stand for
+type typeCmd string
+
+func (c typeCmd) Name() string  { return string(c) }
+func (c typeCmd) Usage() string { return "type [-apt] name ..." }
+func (c typeCmd) LongDesc() string {
+	return `  type echo      tells whether echo is an alias, function, builtin,
+                 plugin command (and its .so file) or a program in $PATH
+  type -a echo   lists everything echo stands for, in the order looked up
+  type -t echo   prints alias, function, builtin, plugin or file
+  type -p echo   prints the file echo runs, if it is a program
+`
+}
+func (c typeCmd) ShortDesc() string {
+	return `tells whether a name is an alias, function, builtin, plugin command or program`
+}
+func (c typeCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	flags, names, err := commandFlags(c.Name(), c.Usage(), "apt", args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	out := api.GetStdout(ctx)
+
+	var result error
+	for _, name := range names {
+		kinds := gosh.resolve(name, flags['a'])
+		if len(kinds) == 0 {
+			if !flags['t'] && !flags['p'] {
+				fmt.Fprintf(api.GetStderr(ctx), "%s: %s: not found\n", c.Name(), name)
+			}
+			result = api.ExitStatus(1)
+			continue
+		}
+		for _, k := range kinds {
+			switch {
+			case flags['t']:
+				fmt.Fprintln(out, k.kind)
+			case flags['p']:
+				if k.kind == "file" {
+					fmt.Fprintln(out, k.value)
+				}
+			default:
+				fmt.Fprintln(out, gosh.describe(name, k))
+			}
+		}
+	}
+	return ctx, result
+}
+
+// whichCmd prints what command names run
+type whichCmd string
+
+func (c whichCmd) Name() string  { return string(c) }
+func (c whichCmd) Usage() string { return "which [-a] name ..." }
+func (c whichCmd) LongDesc() string {
+	return `  which ls       prints the file of a program, or what else the name runs
+  which -a echo  prints everything echo stands for, its plugin command and
+                 every echo program in $PATH
+The status is 1 when a name isn't found.
+`
+}
+func (c whichCmd) ShortDesc() string {
+	return `prints the file of the program, or the command, a name runs`
+}
+func (c whichCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	flags, names, err := commandFlags(c.Name(), c.Usage(), "a", args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	out := api.GetStdout(ctx)
+
+	var result error
+	for _, name := range names {
+		kinds := gosh.resolve(name, flags['a'])
+		if len(kinds) == 0 {
+			result = api.ExitStatus(1)
+		}
+		for _, k := range kinds {
+			switch k.kind {
+			case "alias":
+				fmt.Fprintf(out, "%s: aliased to %s\n", name, k.value)
+			case "function":
+				fmt.Fprintf(out, "%s: shell function\n", name)
+			case "plugin":
+				fmt.Fprintf(out, "%s: plugin command from %s\n", name, k.value)
+			case "builtin":
+				fmt.Fprintf(out, "%s: shell builtin\n", name)
+			default:
+				fmt.Fprintln(out, k.value)
+			}
+		}
+	}
+	return ctx, result
+}
+
+// commandCmd runs a builtin or program, passing over the functions and
+// plugin commands of the same name
+type commandCmd string
+
+func (c commandCmd) Name() string  { return string(c) }
+func (c commandCmd) Usage() string { return "command [-vV] name [arg ...]" }
+func (c commandCmd) LongDesc() string {
+	return `  command echo hi   runs the builtin echo, or else the program in $PATH,
+                    rather than a function or plugin command named echo
+  command -v ls     prints what ls runs: a path, a command name or an alias
+  command -V ls     tells what ls stands for, as type does
+`
+}
+func (c commandCmd) ShortDesc() string {
+	return `runs a builtin or program, bypassing functions and plugin commands`
+}
+func (c commandCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	flags, args, err := commandFlags(c.Name(), c.Usage(), "vV", args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	if len(args) == 0 {
+		return ctx, nil
+	}
+
+	if flags['v'] || flags['V'] {
+		out := api.GetStdout(ctx)
+		var result error
+		for _, name := range args {
+			kinds := gosh.resolve(name, false)
+			switch {
+			case len(kinds) == 0:
+				if flags['V'] {
+					fmt.Fprintf(api.GetStderr(ctx), "%s: %s: not found\n", c.Name(), name)
+				}
+				result = api.ExitStatus(1)
+			case flags['V']:
+				fmt.Fprintln(out, gosh.describe(name, kinds[0]))
+			case kinds[0].kind == "alias":
+				fmt.Fprintf(out, "alias %s=%s\n", name, shellQuote(kinds[0].value))
+			case kinds[0].kind == "file":
+				fmt.Fprintln(out, kinds[0].value)
+			default:
+				fmt.Fprintln(out, name)
+			}
+		}
+		return ctx, result
+	}
+
+	if cmd, ok := gosh.builtins[args[0]]; ok {
+		return gosh.callCommand(ctx, cmd, args)
+	}
+	return ctx, gosh.externalExec(ctx, args[0], args)
+}
+
+// hashCmd lists and manages the programs remembered in the hash table
+type hashCmd string
+
+func (c hashCmd) Name() string  { return string(c) }
+func (c hashCmd) Usage() string { return "hash [-r] [-d name] [name ...]" }
+func (c hashCmd) LongDesc() string {
+	return `  hash           lists the programs found in $PATH so far, and how many times
+                 they ran
+  hash make      looks make up in $PATH and remembers it
+  hash -d make   forgets make, hash -r forgets every program
+The table is also forgotten when $PATH changes.
+`
+}
+func (c hashCmd) ShortDesc() string {
+	return `remembers where programs are in $PATH, hash -r forgets them`
+}
+func (c hashCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	flags, names, err := commandFlags(c.Name(), c.Usage(), "rd", args[1:])
+	if err != nil {
+		return ctx, err
+	}
+	out := api.GetStdout(ctx)
+
+	if flags['r'] {
+		gosh.hash.reset()
+	}
+	var result error
+	if flags['d'] {
+		if len(names) == 0 {
+			return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: -d: option requires an argument\nusage: %s", c.Name(), c.Usage())}
+		}
+		for _, name := range names {
+			if !gosh.hash.forget(name) {
+				fmt.Fprintf(api.GetStderr(ctx), "%s: %s: not found\n", c.Name(), name)
+				result = api.ExitStatus(1)
+			}
+		}
+		return ctx, result
+	}
+	if len(names) == 0 {
+		if flags['r'] {
+			return ctx, nil
+		}
+		entries := gosh.hash.list()
+		if len(entries) == 0 {
+			fmt.Fprintf(out, "%s: hash table empty\n", c.Name())
+			return ctx, nil
+		}
+		fmt.Fprintln(out, "hits\tcommand")
+		for _, e := range entries {
+			fmt.Fprintf(out, "%4d\t%s\n", e.hits, e.file)
+		}
+		return ctx, nil
+	}
+
+	pathList, _ := gosh.getVar("PATH")
+	for _, name := range names {
+		// builtins, plugin commands and paths aren't looked up
+		if _, ok := gosh.commands[name]; ok || strings.Contains(name, "/") {
+			continue
+		}
+		if _, ok := gosh.hash.find(pathList, name, false); !ok {
+			fmt.Fprintf(api.GetStderr(ctx), "%s: %s: not found\n", c.Name(), name)
+			result = api.ExitStatus(1)
+		}
+	}
+	return ctx, result
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellLookup(t *testing.T) {
+	// prog is in both directories, upper is a plugin command and a program
+	first, second := t.TempDir(), t.TempDir()
+	for _, file := range []string{
+		filepath.Join(first, "prog"),
+		filepath.Join(second, "prog"),
+		filepath.Join(second, "upper"),
+	} {
+		script := "#!/bin/sh\necho " + filepath.Base(file) + " \"$@\"\n"
+		if err := os.WriteFile(file, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(first, "data"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []scriptTest{
+		{"type prog", "prog is {1}/prog\n", 0},
+		{"prog; type prog", "prog\nprog is hashed ({1}/prog)\n", 0},
+		{"type -a prog", "prog is {1}/prog\nprog is {2}/prog\n", 0},
+		{"type -t prog upper set", "file\nplugin\nbuiltin\n", 0},
+		{"type -p prog upper", "{1}/prog\n", 0},
+		{"type upper", "upper is a plugin command from /plugins/upper.so\n", 0},
+		{"type -a upper", "upper is a plugin command from /plugins/upper.so\nupper is {2}/upper\n", 0},
+		{"type set", "set is a shell builtin\n", 0},
+		{"f() { args $1; }; type f", "f is a function\nf() { args $1; }\n", 0},
+		{"alias p='prog -x'; type -a p", "p is aliased to `prog -x'\n", 0},
+		{"type data nope; args $?", "type: data: not found\ntype: nope: not found\n[1]\n", 0},
+		{"type -q prog", "type: -q: invalid option\nusage: type [-apt] name ...\n", 2},
+		{"which prog upper set", "{1}/prog\nupper: plugin command from /plugins/upper.so\nset: shell builtin\n", 0},
+		{"which -a prog", "{1}/prog\n{2}/prog\n", 0},
+		{"which nope", "", 1},
+		{"args hi | command upper", "upper\n", 0},
+		{"upper() { args fn; }; command upper x", "upper x\n", 0},
+		{"command set -- a b; args $2", "[b]\n", 0},
+		{"command nope", "command not found: nope\n", 127},
+		{"alias p=prog; command -v prog upper p", "{1}/prog\nupper\nalias p=prog\n", 0},
+		{"command -V prog", "prog is {1}/prog\n", 0},
+		{"hash", "hash: hash table empty\n", 0},
+		{"prog; prog; hash prog; hash", "prog\nprog\nhits\tcommand\n   2\t{1}/prog\n", 0},
+		{"hash prog upper; hash", "hits\tcommand\n   0\t{1}/prog\n", 0},
+		{"hash nope", "hash: nope: not found\n", 1},
+		{"prog; hash -r; hash", "prog\nhash: hash table empty\n", 0},
+		{"hash prog; hash -d prog; hash -d prog", "hash: prog: not found\n", 1},
+		// the program found depends on $PATH
+		{"prog; PATH={2}; prog; hash", "prog\nprog\nhits\tcommand\n   1\t{2}/prog\n", 0},
+		{"PATH=; prog", "command not found: prog\n", 127},
+	}
+	dirs := strings.NewReplacer("{1}", first, "{2}", second)
+	for i := range tests {
+		tests[i].script = dirs.Replace(tests[i].script)
+		tests[i].out = dirs.Replace(tests[i].out)
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.pluginFiles["upper"] = "/plugins/upper.so"
+		shell.setVar("PATH", first+string(os.PathListSeparator)+second)
+	})
+}
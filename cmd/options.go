@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// setOptions are the options changed with set, by name with -o or by
+// their single letter flag
+var setOptions = []struct {
+	name string
+	flag rune
+	desc string
+}{
+	{"errexit", 'e', "exit when a command fails, unless it is a condition"},
+	{"noexec", 'n', "read commands without running them, ignored at the prompt"},
+	{"nounset", 'u', "expanding an unset variable is an error"},
+	{"pipefail", 0, "a pipeline fails with the status of its last failing stage"},
+	{"xtrace", 'x', "print each command once expanded, after the $PS4 prefix"},
+}
+
+// setOption returns the name of the option set by a flag or named name,
+// or "" if there is none
+func setOption(flag rune, name string) string {
+	for _, opt := range setOptions {
+		if (flag != 0 && opt.flag == flag) || (name != "" && opt.name == name) {
+			return opt.name
+		}
+	}
+	return ""
+}
+
+// optionFlags returns the flags of the options that are on, as $- does
+func (gosh *Goshell) optionFlags() string {
+	var sb strings.Builder
+	if gosh.interactive {
+		sb.WriteRune('i')
+	}
+	for _, opt := range setOptions {
+		if opt.flag != 0 && gosh.options[opt.name] {
+			sb.WriteRune(opt.flag)
+		}
+	}
+	return sb.String()
+}
+
+// setCmd sets shell options and the positional parameters
+type setCmd string
+
+func (c setCmd) Name() string  { return string(c) }
+func (c setCmd) Usage() string { return "set [-eunx] [-o option] [--] [arg ...]" }
+func (c setCmd) LongDesc() string {
+	var sb strings.Builder
+	for _, opt := range setOptions {
+		flag := "  "
+		if opt.flag != 0 {
+			flag = "-" + string(opt.flag)
+		}
+		fmt.Fprintf(&sb, "  %s  -o %-10s %s\n", flag, opt.name, opt.desc)
+	}
+	sb.WriteString("+ instead of - turns an option off, the arguments replace $1, $2...\n")
+	return sb.String()
+}
+func (c setCmd) ShortDesc() string {
+	return `sets shell options and positional parameters, or prints the variables`
+}
+func (c setCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	out := api.GetStdout(ctx)
+	if len(args) < 2 {
+		names := make([]string, 0, len(gosh.vars))
+		for name := range gosh.vars {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintln(out, strings.TrimPrefix(declaration(name, gosh.vars[name]), "declare "))
+		}
+		return ctx, nil
+	}
+
+	args = args[1:]
+	for len(args) > 0 {
+		arg := args[0]
+		if arg == "--" {
+			gosh.params = append([]string{}, args[1:]...)
+			return ctx, nil
+		}
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+		on := arg[0] == '-'
+		args = args[1:]
+		for _, flag := range arg[1:] {
+			if flag != 'o' {
+				name := setOption(flag, "")
+				if name == "" {
+					return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %c%c: invalid option\nusage: %s", c.Name(), arg[0], flag, c.Usage())}
+				}
+				gosh.options[name] = on
+				continue
+			}
+			if len(args) == 0 {
+				for _, opt := range setOptions {
+					switch {
+					case !on && gosh.options[opt.name]:
+						fmt.Fprintf(out, "set -o %s\n", opt.name)
+					case !on:
+						fmt.Fprintf(out, "set +o %s\n", opt.name)
+					case gosh.options[opt.name]:
+						fmt.Fprintf(out, "%-10s\ton\n", opt.name)
+					default:
+						fmt.Fprintf(out, "%-10s\toff\n", opt.name)
+					}
+				}
+				continue
+			}
+			name := setOption(0, args[0])
+			if name == "" {
+				return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: %s: invalid option name", c.Name(), args[0])}
+			}
+			gosh.options[name] = on
+			args = args[1:]
+		}
+	}
+	if len(args) > 0 {
+		gosh.params = append([]string{}, args...)
+	}
+	return ctx, nil
+}
+
+// failed handles the result of a command that isn't a condition: when it
+// failed, the ERR trap runs and set -e ends the session
+func (gosh *Goshell) failed(ctx context.Context, err error) error {
+	if err == nil || unwinds(err) || gosh.condDepth > 0 {
+		return err
+	}
+	if cmd, ok := gosh.traps["ERR"]; ok {
+		gosh.status = api.Status(err)
+		if trapErr := gosh.runTrap(ctx, cmd); trapErr != nil {
+			return trapErr
+		}
+	}
+	if !gosh.options["errexit"] {
+		return err
+	}
+	gosh.reportError(ctx, err)
+	return api.ExitShell(api.Status(err))
+}
+
+// condition runs a command whose failure is tested rather than an error,
+// set -e ignores it
+func (gosh *Goshell) condition(ctx context.Context, n node) (context.Context, error) {
+	gosh.condDepth++
+	defer func() { gosh.condDepth-- }()
+	return gosh.exec(ctx, n)
+}
+
+// unboundError is the error of expanding an unset variable with set -u
+type unboundError string
+
+func (e unboundError) Error() string { return string(e) + ": unbound variable" }
+func (e unboundError) ExitCode() int { return 127 }
+
+// trace prints a command about to run with set -x, its assignments are
+// given as written and its arguments are quoted to read back the same
+func (gosh *Goshell) trace(ctx context.Context, assigns, args []string) {
+	if !gosh.options["xtrace"] || len(assigns)+len(args) == 0 {
+		return
+	}
+	prefix, ok := gosh.getVar("PS4")
+	if !ok {
+		prefix = "+ "
+	}
+	words := append([]string{}, assigns...)
+	for _, arg := range args {
+		words = append(words, shellQuote(arg))
+	}
+	fmt.Fprintf(api.GetStderr(ctx), "%s%s\n", prefix, strings.Join(words, " "))
+}
+
+// tracedAssign returns how set -x prints the assignment of a variable
+func (gosh *Goshell) tracedAssign(name string) string {
+	v, ok := gosh.vars[name]
+	if !ok || v.elems == nil {
+		value, _ := gosh.getVar(name)
+		return name + "=" + shellQuote(value)
+	}
+	values := gosh.arrayValues(name, false)
+	for i, value := range values {
+		values[i] = shellQuote(value)
+	}
+	return name + "=(" + strings.Join(values, " ") + ")"
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestShellSetOptions(t *testing.T) {
+	tests := []scriptTest{
+		{"set -e; args one; false; args never", "[one]\n", 1},
+		{"set -e; nosuch; args never", "command not found: nosuch\n", 127},
+		{"set -e\nif false; then true; fi\nwhile false; do true; done\n! true\nfalse || args or\nfalse && true\n[[ a == b ]] || true\nargs alive", "[or]\n[alive]\n", 0},
+		{"set -e; f() { false; args in-f; }; f || args failed; f; args never", "[in-f]\n", 1},
+		{"set -e; X=$(false); args never", "", 1},
+		{"set -e; ((0)); args never", "", 1},
+		{"set -e; for x in a b; do args $x; false; done", "[a]\n", 1},
+		{"set -e; set +e; false; args continued", "[continued]\n", 0},
+		{"set -u; args ${X-default} ${X:+set} $# \"$@\"; args $X; args never", "[default][0]\nX: unbound variable\n", 127},
+		{"set -u; args ${#X}", "X: unbound variable\n", 127},
+		{"set -o pipefail; false | upper; args $?; true | upper; args $?", "[1]\n[0]\n", 0},
+		{"set -o pipefail; false | sh -c 'exit 3' | true; args $?", "[3]\n", 0},
+		{"false | upper; args $?", "[0]\n", 0},
+		{"set -x; X=1 A=(a 'b c'); args \"a b\" $X > /dev/null; PS4='>> '; args", "+ X=1 A=(a 'b c')\n+ args 'a b' 1\n>> PS4='>> '\n>> args\n\n", 0},
+		{"set -n\nargs never\nset +n\nargs never", "", 0},
+		{"set -n; args never", "", 0},
+		{"set -eu -o pipefail; args $-; set +eu; args \"$-\"", "[eu]\n[]\n", 0},
+		{"set -o pipefail -x; set -o; set +x; set +o", "+ set -o\nerrexit   \toff\nnoexec    \toff\nnounset   \toff\npipefail  \ton\nxtrace    \ton\n+ set +x\nset +o errexit\nset +o noexec\nset +o nounset\nset -o pipefail\nset +o xtrace\n", 0},
+		{"set -- a 'b c'; args $# \"$2\"; set x; args $@; set --; args $#", "[2][b c]\n[x]\n[0]\n", 0},
+		{"set -q", "set: -q: invalid option\nusage: set [-eunx] [-o option] [--] [arg ...]\n", 2},
+		{"set -o nosuch", "set: nosuch: invalid option name\n", 2},
+	}
+	runScripts(t, tests, nil)
+
+	// at the prompt, set -n is ignored so that it can be turned off
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.interactive = true
+	runLines(t, shell, out, "set -n", "args runs")
+	if got := out.String(); got != "[runs]\n" {
+		t.Errorf("got %q, want %q", got, "[runs]\n")
+	}
+}
@@ -0,0 +1,910 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// wordPart is one piece of a shell word, a word such as `"$HOME"/src`
+// is made of several parts that are expanded independently and then joined.
+type wordPart interface{}
+
+// litPart is literal text, quoted text is never subject to globbing or
+// field splitting.
+type litPart struct {
+	text   string
+	quoted bool
+}
+
+// paramPart is a parameter expansion such as $NAME or ${NAME:-word}, op is
+// the expansion operator applied with arg as its operand and length is set
+// for ${#NAME}. For arrays, index is the subscript of ${NAME[index]}, list
+// is @ or * for ${NAME[@]} and ${NAME[*]} and keys is set for ${!NAME[@]}.
+type paramPart struct {
+	name   string
+	op     string
+	arg    word
+	length bool
+	quoted bool
+	index  word
+	list   string
+	keys   bool
+}
+
+// cmdSubstPart is a command substitution, $(src) or `src`, replaced by the
+// output of src
+type cmdSubstPart struct {
+	src    string
+	quoted bool
+}
+
+// word is a single shell word as written on the command line
+type word []wordPart
+
+// node is an element of the command tree produced by the parser
+type node interface{}
+
+// simpleCmd is a command name followed by its arguments and the
+// redirections of its streams, assignments preceding the command name
+// only apply to the command itself unless the command name is omitted.
+// text is its source, naming the job it becomes when stopped.
+type simpleCmd struct {
+	assigns []assign
+	args    []word
+	redirs  []*redirect
+	text    string
+}
+
+// assign is a NAME=value variable assignment, NAME[index]=value sets an
+// array element and NAME=(value ...) a whole array. add is set for +=,
+// which appends to the variable.
+type assign struct {
+	name  string
+	value word
+	index word
+	elems []arrayElem
+	array bool
+	add   bool
+}
+
+// redirect redirects one of the standard streams of a command, op is one
+// of < > >> <& >& &> &>> or, feeding the command text from the command
+// line, << and <<- for here-documents and <<< for here-strings. The body
+// of a here-document is kept in heredoc, its target is the delimiter.
+type redirect struct {
+	fd      int
+	op      string
+	target  word
+	heredoc word
+}
+
+// pipeline is a sequence of commands whose output feeds the next one's
+// input, text is its source
+type pipeline struct {
+	cmds   []node
+	negate bool
+	text   string
+}
+
+// andOrCmd runs right only if left succeeded (&&) or failed (||)
+type andOrCmd struct {
+	op    string
+	left  node
+	right node
+}
+
+// cmdList is a sequence of commands run one after the other
+type cmdList struct {
+	cmds []node
+}
+
+// backgroundCmd runs cmd as a job without waiting for it, text is the
+// command as written for the job table
+type backgroundCmd struct {
+	cmd  node
+	text string
+}
+
+// errIncomplete is returned for input ending in the middle of a command,
+// the interactive shell reads more lines to complete it
+var errIncomplete = errors.New("unexpected end of input")
+
+// incomplete returns a syntax error for input ending before what
+func incomplete(what string) error {
+	return fmt.Errorf("syntax error: %s: %w", what, errIncomplete)
+}
+
+// syntaxError is a command line the parser rejects, it sets the exit
+// status 2
+type syntaxError struct {
+	err error
+}
+
+func (e syntaxError) Error() string { return e.err.Error() }
+func (e syntaxError) Unwrap() error { return e.err }
+func (e syntaxError) ExitCode() int { return 2 }
+
+// parser turns a command line into a command tree
+type parser struct {
+	src []rune
+	pos int
+	// heredocs are the here-documents whose body starts after the next
+	// newline
+	heredocs []*redirect
+	// aliases are expanded where a command starts, aliasEnd holds the end
+	// of the text each alias was replaced with so an alias is not expanded
+	// again within its own value
+	aliases  map[string]string
+	aliasEnd map[string]int
+}
+
+// parse parses a command line and returns its command tree, a nil node
+// is returned for blank input.
+func parse(src string) (node, error) {
+	p := &parser{src: []rune(src)}
+	return p.parse()
+}
+
+func (p *parser) parse() (node, error) {
+	tree, err := p.list()
+	if err != nil {
+		return nil, err
+	}
+	p.skipBlanks()
+	if !p.eof() {
+		return nil, p.unexpected()
+	}
+	if len(p.heredocs) > 0 {
+		return nil, incomplete("here-document")
+	}
+	return tree, nil
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) peekAt(offset int) rune {
+	if p.pos+offset >= len(p.src) {
+		return 0
+	}
+	return p.src[p.pos+offset]
+}
+
+func (p *parser) next() rune {
+	r := p.peek()
+	p.pos++
+	return r
+}
+
+// skipBlanks skips spaces, tabs, escaped newlines and comments, which
+// start with a # where a word could start
+func (p *parser) skipBlanks() {
+	for !p.eof() {
+		switch p.peek() {
+		case ' ', '\t':
+			p.pos++
+		case '\\':
+			// an escaped newline joins two lines
+			if p.peekAt(1) != '\n' {
+				return
+			}
+			p.pos += 2
+		case '#':
+			// a comment runs to the end of the line
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// unexpected returns a syntax error for the token at the current position
+func (p *parser) unexpected() error {
+	if p.eof() {
+		return fmt.Errorf("syntax error: %w", errIncomplete)
+	}
+	tok := string(p.peek())
+	if kw := p.keyword(); kw != "" {
+		tok = kw
+	}
+	for _, op := range []string{"&&", "||", ";;", ">>", "<<", "&>", ">&"} {
+		if p.hasPrefix(op) {
+			tok = op
+			break
+		}
+	}
+	return fmt.Errorf("syntax error near unexpected token `%s'", tok)
+}
+
+func (p *parser) hasPrefix(s string) bool {
+	return strings.HasPrefix(string(p.src[p.pos:]), s)
+}
+
+// isMeta reports whether r ends an unquoted word
+func isMeta(r rune) bool {
+	switch r {
+	case ' ', '\t', '\n', ';', '&', '|', '<', '>', '(', ')':
+		return true
+	}
+	return false
+}
+
+// list parses commands separated by ; & or newlines, & running the
+// command before it in the background
+func (p *parser) list() (node, error) {
+	var cmds []node
+	for {
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+		start := p.pos
+		cmd, err := p.andOr()
+		if err != nil {
+			return nil, err
+		}
+		if cmd == nil {
+			break
+		}
+		p.skipBlanks()
+		if p.peek() == '&' {
+			text := strings.TrimSpace(string(p.src[start:p.pos]))
+			cmds = append(cmds, &backgroundCmd{cmd: cmd, text: text})
+			p.pos++
+			continue
+		}
+		cmds = append(cmds, cmd)
+		if p.peek() == ';' && p.peekAt(1) != ';' {
+			p.pos++
+			continue
+		}
+		if p.peek() != '\n' {
+			break
+		}
+	}
+	switch len(cmds) {
+	case 0:
+		return nil, nil
+	case 1:
+		return cmds[0], nil
+	}
+	return &cmdList{cmds: cmds}, nil
+}
+
+// andOr parses pipelines separated by && or ||
+func (p *parser) andOr() (node, error) {
+	left, err := p.pipeline()
+	if err != nil || left == nil {
+		return left, err
+	}
+	for {
+		p.skipBlanks()
+		op := ""
+		if p.hasPrefix("&&") || p.hasPrefix("||") {
+			op = string(p.src[p.pos : p.pos+2])
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.pos += 2
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+		right, err := p.pipeline()
+		if err != nil {
+			return nil, err
+		}
+		if right == nil {
+			return nil, p.unexpected()
+		}
+		left = &andOrCmd{op: op, left: left, right: right}
+	}
+}
+
+// skipNewlines skips blanks and newlines, reading the body of pending
+// here-documents after each newline
+func (p *parser) skipNewlines() error {
+	for p.skipBlanks(); p.peek() == '\n'; p.skipBlanks() {
+		p.pos++
+		if err := p.heredocBodies(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// heredocBodies reads the bodies of the pending here-documents, each one
+// ends with a line holding only its delimiter
+func (p *parser) heredocBodies() error {
+	for _, redir := range p.heredocs {
+		delim := ""
+		quoted := false
+		for _, part := range redir.target {
+			if lit, ok := part.(litPart); ok {
+				delim += lit.text
+				quoted = quoted || lit.quoted
+			}
+		}
+
+		var body strings.Builder
+		for {
+			if p.eof() {
+				return incomplete("here-document delimited by " + delim)
+			}
+			start := p.pos
+			for !p.eof() && p.peek() != '\n' {
+				p.pos++
+			}
+			line := string(p.src[start:p.pos])
+			if !p.eof() {
+				p.pos++ // newline
+			}
+			if redir.op == "<<-" {
+				line = strings.TrimLeft(line, "\t")
+			}
+			if line == delim {
+				break
+			}
+			body.WriteString(line + "\n")
+		}
+
+		// a quoted delimiter turns off expansions in the body
+		if quoted {
+			redir.heredoc = word{litPart{text: body.String(), quoted: true}}
+			continue
+		}
+		bp := &parser{src: []rune(body.String())}
+		parts, err := bp.quotedParts(false)
+		if err != nil {
+			return err
+		}
+		redir.heredoc = parts
+	}
+	p.heredocs = nil
+	return nil
+}
+
+// pipeline parses commands separated by |, optionally preceded by ! to
+// invert its status. A single command is returned as is.
+func (p *parser) pipeline() (node, error) {
+	negate := false
+	if p.skipBlanks(); p.keyword() == "!" {
+		p.pos++
+		negate = true
+		p.skipBlanks()
+	}
+	start, end := p.pos, p.pos
+	var cmds []node
+	for {
+		cmd, err := p.command()
+		if err != nil {
+			return nil, err
+		}
+		end = p.pos
+		p.skipBlanks()
+		if cmd == nil {
+			if len(cmds) > 0 || negate {
+				return nil, p.unexpected()
+			}
+			return nil, nil
+		}
+		cmds = append(cmds, cmd)
+		if p.peek() != '|' || p.peekAt(1) == '|' {
+			break
+		}
+		p.pos++
+		if err := p.skipNewlines(); err != nil {
+			return nil, err
+		}
+		if p.eof() || isMeta(p.peek()) {
+			return nil, p.unexpected()
+		}
+	}
+	if len(cmds) == 1 && !negate {
+		return cmds[0], nil
+	}
+	text := string(p.src[start:end])
+	return &pipeline{cmds: cmds, negate: negate, text: text}, nil
+}
+
+// simpleCommand parses a command name, its arguments and redirections
+func (p *parser) simpleCommand() (*simpleCmd, error) {
+	cmd := &simpleCmd{}
+	start, end := p.pos, p.pos
+	for ; ; end = p.pos {
+		p.skipBlanks()
+		if p.eof() {
+			break
+		}
+		if redir, ok, err := p.redirect(); err != nil {
+			return nil, err
+		} else if ok {
+			cmd.redirs = append(cmd.redirs, redir)
+			if redir.op == "<<" || redir.op == "<<-" {
+				// the body follows the next newline
+				p.heredocs = append(p.heredocs, redir)
+			}
+			continue
+		}
+		if isMeta(p.peek()) {
+			break
+		}
+		if len(cmd.args) == 0 {
+			if as, ok, err := p.assignment(); err != nil {
+				return nil, err
+			} else if ok {
+				cmd.assigns = append(cmd.assigns, as)
+				continue
+			}
+		} else if isDeclaration(cmd.args[0]) {
+			// declare and local get NAME=(value ...) as written, they
+			// expand the elements themselves
+			start := p.pos
+			if as, ok, err := p.assignment(); err != nil {
+				return nil, err
+			} else if ok && as.array {
+				cmd.args = append(cmd.args, word{litPart{text: string(p.src[start:p.pos]), quoted: true}})
+				continue
+			}
+			p.pos = start
+		}
+		w, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		cmd.args = append(cmd.args, w)
+	}
+	if len(cmd.args) == 0 && len(cmd.redirs) == 0 && len(cmd.assigns) == 0 {
+		return nil, nil
+	}
+	// the blanks and comment after the command are left to the caller
+	p.pos = end
+	cmd.text = string(p.src[start:end])
+	return cmd, nil
+}
+
+// isDeclaration reports whether w names one of the declarationCmds
+func isDeclaration(w word) bool {
+	if len(w) != 1 {
+		return false
+	}
+	lit, ok := w[0].(litPart)
+	return ok && !lit.quoted && declarationCmds[lit.text]
+}
+
+// redirect parses a redirection operator, optionally preceded by the
+// number of the redirected stream, and its target word
+func (p *parser) redirect() (*redirect, bool, error) {
+	start := p.pos
+	fd := -1
+	for p.peek() >= '0' && p.peek() <= '9' {
+		fd = max(fd, 0)*10 + int(p.next()-'0')
+	}
+	redir := &redirect{}
+	for _, op := range []string{"&>>", "&>", ">>", ">&", ">|", ">", "<<<", "<<-", "<<", "<&", "<"} {
+		if p.hasPrefix(op) {
+			redir.op = op
+			break
+		}
+	}
+	if redir.op == "" || (fd >= 0 && redir.op[0] == '&') {
+		p.pos = start
+		return redir, false, nil
+	}
+	p.pos += len(redir.op)
+	if redir.op == ">|" {
+		redir.op = ">"
+	}
+
+	redir.fd = fd
+	if fd < 0 {
+		redir.fd = 1
+		if redir.op[0] == '<' {
+			redir.fd = 0
+		}
+	}
+
+	p.skipBlanks()
+	if p.eof() || isMeta(p.peek()) {
+		return redir, false, p.unexpected()
+	}
+	target, err := p.word()
+	if err != nil {
+		return redir, false, err
+	}
+	redir.target = target
+	return redir, true, nil
+}
+
+// assignment parses a NAME=value assignment, if there is one at the
+// current position
+func (p *parser) assignment() (assign, bool, error) {
+	start := p.pos
+	if !isNameStart(p.peek()) {
+		return assign{}, false, nil
+	}
+	for isNameChar(p.peek()) {
+		p.pos++
+	}
+	if p.peek() != '=' && p.peek() != '[' && !p.hasPrefix("+=") {
+		p.pos = start
+		return assign{}, false, nil
+	}
+	as := assign{name: string(p.src[start:p.pos])}
+	if p.peek() == '[' {
+		p.pos++
+		index, err := p.subscript()
+		if err != nil {
+			// not an assignment, such as the pattern x[ab]
+			p.pos = start
+			return assign{}, false, nil
+		}
+		as.index = index
+	}
+	if p.hasPrefix("+=") {
+		as.add = true
+		p.pos++
+	}
+	if p.peek() != '=' {
+		p.pos = start
+		return assign{}, false, nil
+	}
+	p.pos++ // =
+	if p.peek() == '(' && as.index == nil {
+		elems, err := p.arrayLiteral()
+		if err != nil {
+			return as, false, err
+		}
+		as.elems, as.array = elems, true
+		return as, true, nil
+	}
+	value, err := p.word()
+	if err != nil {
+		return as, false, err
+	}
+	as.value = value
+	return as, true, nil
+}
+
+func isNameStart(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isNameChar(r rune) bool {
+	return isNameStart(r) || (r >= '0' && r <= '9')
+}
+
+// isName reports whether s is a valid variable name
+func isName(s string) bool {
+	for i, r := range s {
+		if !isNameChar(r) || (i == 0 && !isNameStart(r)) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// word reads a single word, handling quotes, backslash escapes and
+// expansions
+func (p *parser) word() (word, error) {
+	return p.wordUntil(isMeta)
+}
+
+// wordUntil reads the parts of a word up to the first unquoted rune for
+// which end returns true
+func (p *parser) wordUntil(end func(rune) bool) (word, error) {
+	var w word
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			w = append(w, litPart{text: lit.String()})
+			lit.Reset()
+		}
+	}
+	for !p.eof() && !end(p.peek()) {
+		switch r := p.peek(); r {
+		case '\\':
+			p.pos++
+			if p.eof() {
+				lit.WriteRune('\\')
+				continue
+			}
+			if esc := p.next(); esc != '\n' {
+				flush()
+				w = append(w, litPart{text: string(esc), quoted: true})
+			}
+		case '\'':
+			flush()
+			part, err := p.singleQuoted()
+			if err != nil {
+				return nil, err
+			}
+			w = append(w, part)
+		case '"':
+			flush()
+			parts, err := p.doubleQuoted()
+			if err != nil {
+				return nil, err
+			}
+			w = append(w, parts...)
+		case '$':
+			flush()
+			part, err := p.dollar(false)
+			if err != nil {
+				return nil, err
+			}
+			w = append(w, part)
+		case '`':
+			flush()
+			part, err := p.backquoted(false)
+			if err != nil {
+				return nil, err
+			}
+			w = append(w, part)
+		default:
+			lit.WriteRune(p.next())
+		}
+	}
+	flush()
+	return w, nil
+}
+
+// singleQuoted reads '...', everything up to the closing quote is literal
+func (p *parser) singleQuoted() (wordPart, error) {
+	p.pos++ // opening quote
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.pos++
+	}
+	if p.eof() {
+		return nil, incomplete("unterminated single quote")
+	}
+	text := string(p.src[start:p.pos])
+	p.pos++ // closing quote
+	return litPart{text: text, quoted: true}, nil
+}
+
+// doubleQuoted reads "...", a backslash only escapes $ ` " \ and newline
+// and parameters are expanded
+func (p *parser) doubleQuoted() ([]wordPart, error) {
+	p.pos++ // opening quote
+	return p.quotedParts(true)
+}
+
+// quotedParts parses text where only $ and ` expansions are recognized,
+// up to the closing double quote or, for here-document bodies which are
+// not closed, the end of input
+func (p *parser) quotedParts(closed bool) ([]wordPart, error) {
+	var parts []wordPart
+	var lit strings.Builder
+	flush := func() {
+		if lit.Len() > 0 {
+			parts = append(parts, litPart{text: lit.String(), quoted: true})
+			lit.Reset()
+		}
+	}
+	for {
+		if p.eof() && closed {
+			return nil, incomplete("unterminated double quote")
+		}
+		switch r := p.peek(); {
+		case p.eof(), r == '"' && closed:
+			p.pos++
+			flush()
+			if len(parts) == 0 {
+				// "" is still an (empty) word
+				parts = append(parts, litPart{quoted: true})
+			}
+			return parts, nil
+		case r == '\\':
+			p.pos++
+			switch esc := p.peek(); {
+			case esc == '$', esc == '`', esc == '\\', esc == '"' && closed:
+				lit.WriteRune(p.next())
+			case esc == '\n':
+				p.pos++
+			default:
+				lit.WriteRune(r)
+			}
+		case r == '$':
+			flush()
+			part, err := p.dollar(true)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		case r == '`':
+			flush()
+			part, err := p.backquoted(true)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		default:
+			lit.WriteRune(p.next())
+		}
+	}
+}
+
+// dollar parses an expansion starting with $, a $ that does not start an
+// expansion is literal
+func (p *parser) dollar(quoted bool) (wordPart, error) {
+	p.pos++ // $
+	switch r := p.peek(); {
+	case r == '(' && p.peekAt(1) == '(':
+		p.pos += 2
+		expr, err := p.arithExpr()
+		if err != nil {
+			return nil, err
+		}
+		return arithPart{expr: expr, quoted: quoted}, nil
+	case r == '(':
+		return p.cmdSubst(quoted)
+	case r == '{':
+		return p.braceParam(quoted)
+	case isNameStart(r):
+		start := p.pos
+		for isNameChar(p.peek()) {
+			p.pos++
+		}
+		return paramPart{name: string(p.src[start:p.pos]), quoted: quoted}, nil
+	case isSpecialParam(r):
+		p.pos++
+		return paramPart{name: string(r), quoted: quoted}, nil
+	}
+	return litPart{text: "$", quoted: quoted}, nil
+}
+
+// cmdSubst parses $(...), the commands are parsed to find the closing
+// parenthesis and kept as source to be run when the word is expanded
+func (p *parser) cmdSubst(quoted bool) (wordPart, error) {
+	p.pos++ // (
+	start := p.pos
+	if _, err := p.list(); err != nil {
+		return nil, err
+	}
+	p.skipBlanks()
+	if p.eof() {
+		return nil, incomplete("unterminated $(")
+	}
+	if p.peek() != ')' {
+		return nil, p.unexpected()
+	}
+	src := string(p.src[start:p.pos])
+	p.pos++ // )
+	return cmdSubstPart{src: src, quoted: quoted}, nil
+}
+
+// backquoted parses the legacy `...` form of command substitution, inside
+// which a backslash escapes $ ` and \ so that substitutions can be nested
+func (p *parser) backquoted(quoted bool) (wordPart, error) {
+	p.pos++ // opening backquote
+	var src strings.Builder
+	for {
+		if p.eof() {
+			return nil, incomplete("unterminated `")
+		}
+		r := p.next()
+		switch {
+		case r == '`':
+			return cmdSubstPart{src: src.String(), quoted: quoted}, nil
+		case r == '\\' && strings.ContainsRune("$`\\", p.peek()) && !p.eof():
+			src.WriteRune(p.next())
+		default:
+			src.WriteRune(r)
+		}
+	}
+}
+
+// isSpecialParam reports whether r names a special or positional parameter
+func isSpecialParam(r rune) bool {
+	return r != 0 && strings.ContainsRune("?$#@*!-0123456789", r)
+}
+
+// paramOps are the operators of ${NAME<op>word} expansions, longest first
+var paramOps = []string{":-", ":=", ":?", ":+", "-", "=", "?", "+", "##", "#", "%%", "%"}
+
+// braceParam parses ${...} parameter expansions
+func (p *parser) braceParam(quoted bool) (wordPart, error) {
+	p.pos++ // {
+	part := paramPart{quoted: quoted}
+	if p.peek() == '#' && p.peekAt(1) != '}' {
+		part.length = true
+		p.pos++
+	} else if p.peek() == '!' && isNameStart(p.peekAt(1)) {
+		part.keys = true
+		p.pos++
+	}
+
+	start := p.pos
+	switch r := p.peek(); {
+	case isNameStart(r):
+		for isNameChar(p.peek()) {
+			p.pos++
+		}
+	case r >= '0' && r <= '9':
+		for p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+		}
+	case isSpecialParam(r):
+		p.pos++
+	}
+	part.name = string(p.src[start:p.pos])
+	if isName(part.name) && p.peek() == '[' {
+		p.pos++
+		if p.hasPrefix("@]") || p.hasPrefix("*]") {
+			part.list = string(p.next())
+			p.pos++
+		} else {
+			index, err := p.subscript()
+			if err != nil {
+				return nil, err
+			}
+			part.index = index
+		}
+	}
+	if part.keys && part.list == "" {
+		return nil, errors.New("bad substitution")
+	}
+
+	if part.name != "" && !part.length {
+		for _, op := range paramOps {
+			if p.hasPrefix(op) {
+				part.op = op
+				p.pos += len(op)
+				break
+			}
+		}
+	}
+	if part.op != "" {
+		arg, err := p.wordUntil(func(r rune) bool { return r == '}' })
+		if err != nil {
+			return nil, err
+		}
+		// the operand of # and % stays a pattern between double quotes
+		if quoted && !isTrimOp(part.op) {
+			arg = quoteWord(arg)
+		}
+		part.arg = arg
+	}
+
+	if p.eof() {
+		return nil, incomplete("unterminated ${")
+	}
+	if part.name == "" || p.peek() != '}' {
+		return nil, errors.New("bad substitution")
+	}
+	p.pos++ // }
+	return part, nil
+}
+
+// quoteWord marks every part of w as quoted
+func quoteWord(w word) word {
+	quoted := make(word, len(w))
+	for i, part := range w {
+		switch part := part.(type) {
+		case litPart:
+			part.quoted = true
+			quoted[i] = part
+		case paramPart:
+			part.quoted = true
+			quoted[i] = part
+		case cmdSubstPart:
+			part.quoted = true
+			quoted[i] = part
+		default:
+			quoted[i] = part
+		}
+	}
+	return quoted
+}
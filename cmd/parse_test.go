@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuoting(t *testing.T) {
+	tests := []struct {
+		line string
+		args []string
+	}{
+		{`echo hello world`, []string{"echo", "hello", "world"}},
+		{`echo "hello world"`, []string{"echo", "hello world"}},
+		{`cd "My Documents"`, []string{"cd", "My Documents"}},
+		{`grep 'a b' file`, []string{"grep", "a b", "file"}},
+		{`echo a\ b`, []string{"echo", "a b"}},
+		{`echo "a \"quoted\" \$word" 'it''s'`, []string{"echo", `a "quoted" $word`, "its"}},
+		{`echo "back\slash" ''`, []string{"echo", `back\slash`, ""}},
+		{"echo one \\\n two", []string{"echo", "one", "two"}},
+		{`echo pre"mid"'post'`, []string{"echo", "premidpost"}},
+	}
+	shell := New()
+	for _, test := range tests {
+		tree, err := parse(test.line)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		sc, ok := tree.(*simpleCmd)
+		if !ok {
+			t.Errorf("%s: expected a simple command, got %T", test.line, tree)
+			continue
+		}
+		args, err := shell.expandWords(context.TODO(), sc.args)
+		if err != nil {
+			t.Errorf("%s: %v", test.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: got %q, want %q", test.line, args, test.args)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		line string
+		text string
+	}{
+		{`sleep 5  # nap`, `sleep 5`},
+		{`  X=1 prog "a  b" > out`, `X=1 prog "a  b" > out`},
+		{`sleep 30 | grep 'a  b'  # filter`, `sleep 30 | grep 'a  b'`},
+		{"cat |\n  sort", "cat |\n  sort"},
+		{`! false |  true`, `false |  true`},
+	}
+	for _, test := range tests {
+		tree, err := parse(test.line)
+		if err != nil {
+			t.Errorf("%q: %v", test.line, err)
+			continue
+		}
+		text := ""
+		switch n := tree.(type) {
+		case *simpleCmd:
+			text = n.text
+		case *pipeline:
+			text = n.text
+		}
+		if text != test.text {
+			t.Errorf("%q: got text %q, want %q", test.line, text, test.text)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, line := range []string{`echo "open`, `echo 'open`} {
+		if _, err := parse(line); err == nil {
+			t.Errorf("%s: expected a syntax error", line)
+		}
+	}
+}
+
+func TestParseIncomplete(t *testing.T) {
+	incomplete := []string{"cat <<EOF\nbody\n", "echo a |\n", "echo a &&", "echo $(date", "echo 'open\n"}
+	for _, line := range incomplete {
+		if _, err := parse(line); !errors.Is(err, errIncomplete) {
+			t.Errorf("%q: got %v, want an incomplete input error", line, err)
+		}
+	}
+	if _, err := parse("echo a )"); err == nil || errors.Is(err, errIncomplete) {
+		t.Errorf("echo a ): got %v, want a syntax error", err)
+	}
+}
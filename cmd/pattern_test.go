@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		match      bool
+	}{
+		{"*", "", true},
+		{"*.go", "gosh.go", true},
+		{"*.go", "dir/gosh.go", true},
+		{"*.go", "gosh.md", false},
+		{"g?sh", "gosh", true},
+		{"g?sh", "gsh", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]x", "bx", false},
+		{"[]]", "]", true},
+		{"[[:digit:]]*", "1abc", true},
+		{"[[:upper:]]", "a", false},
+		{`\*`, "*", true},
+		{`\*`, "x", false},
+		{"[abc", "[abc", true},
+		{"a*b*c", "aXbYbZc", true},
+	}
+	for _, test := range tests {
+		if got := matchPattern(test.pattern, test.s); got != test.match {
+			t.Errorf("matchPattern(%q, %q) = %v, want %v", test.pattern, test.s, got, test.match)
+		}
+	}
+}
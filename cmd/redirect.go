@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// streamKeys are the context keys of the standard streams, indexed by
+// their file descriptor number
+var streamKeys = [...]string{"gosh.stdin", "gosh.stdout", "gosh.stderr"}
+
+// redirect applies a command's redirections in order and returns a context
+// carrying the redirected streams, and a function that closes the files
+// opened for them.
+func (gosh *Goshell) redirect(ctx context.Context, redirs []*redirect) (context.Context, func(), error) {
+	var files []*os.File
+	closeFiles := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+
+	var streams [len(streamKeys)]interface{}
+	for fd, key := range streamKeys {
+		streams[fd] = ctx.Value(key)
+	}
+
+	for _, redir := range redirs {
+		if redir.fd >= len(streams) {
+			closeFiles()
+			return ctx, nil, fmt.Errorf("%d: bad file descriptor", redir.fd)
+		}
+
+		// here-documents and here-strings feed the expanded text itself
+		if redir.op == "<<" || redir.op == "<<-" || redir.op == "<<<" {
+			body, suffix := redir.heredoc, ""
+			if redir.op == "<<<" {
+				body, suffix = redir.target, "\n"
+			}
+			text, err := gosh.expandString(ctx, body)
+			if err != nil {
+				closeFiles()
+				return ctx, nil, err
+			}
+			f, err := heredocFile(text + suffix)
+			if err != nil {
+				closeFiles()
+				return ctx, nil, err
+			}
+			files = append(files, f)
+			streams[redir.fd] = f
+			continue
+		}
+
+		target, err := gosh.expandRedirectTarget(ctx, redir.target)
+		if err != nil {
+			closeFiles()
+			return ctx, nil, err
+		}
+		op := redir.op
+
+		// duplicating a stream, a target that is not a number names a file
+		// as in >&file
+		if op == ">&" || op == "<&" {
+			if srcFd, err := strconv.Atoi(target); err == nil {
+				if srcFd < 0 || srcFd >= len(streams) {
+					closeFiles()
+					return ctx, nil, fmt.Errorf("%d: bad file descriptor", srcFd)
+				}
+				streams[redir.fd] = streams[srcFd]
+				continue
+			}
+			if op == "<&" {
+				closeFiles()
+				return ctx, nil, fmt.Errorf("%s: ambiguous redirect", target)
+			}
+			op = "&>"
+		}
+
+		var flag int
+		switch op {
+		case "<":
+			flag = os.O_RDONLY
+		case ">", "&>":
+			flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		case ">>", "&>>":
+			flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		}
+		f, err := os.OpenFile(target, flag, 0666)
+		if err != nil {
+			closeFiles()
+			return ctx, nil, err
+		}
+		files = append(files, f)
+
+		if op == "&>" || op == "&>>" {
+			streams[1], streams[2] = f, f
+			continue
+		}
+		streams[redir.fd] = f
+	}
+
+	for fd, stream := range streams {
+		ctx = context.WithValue(ctx, streamKeys[fd], stream)
+	}
+	return ctx, closeFiles, nil
+}
+
+// heredocFile returns an unlinked temporary file holding text. A file,
+// unlike an in-memory reader, is only read by the commands that read their
+// stdin, external commands get it as is rather than through a copy.
+func heredocFile(text string) (*os.File, error) {
+	f, err := os.CreateTemp("", "gosh-heredoc")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(f.Name())
+	if _, err := f.WriteString(text); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// expandRedirectTarget expands the target of a redirection, which must
+// expand to a single field
+func (gosh *Goshell) expandRedirectTarget(ctx context.Context, target word) (string, error) {
+	fields, err := gosh.expandWords(ctx, []word{target})
+	if err != nil {
+		return "", err
+	}
+	if len(fields) != 1 {
+		return "", fmt.Errorf("%s: ambiguous redirect", strings.Join(fields, " "))
+	}
+	return fields[0], nil
+}
+
+// restoreStreams puts the streams of orig back into the context returned by
+// a command that ran with redirected streams, so the redirections do not
+// outlive the command.
+func restoreStreams(ctx, orig context.Context) context.Context {
+	for _, key := range streamKeys {
+		ctx = context.WithValue(ctx, key, orig.Value(key))
+	}
+	return ctx
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestShellRedirect(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "out.txt")
+	both := `sh -c 'echo out; echo err >&2'`
+	tests := []struct {
+		line string
+		out  string
+		file string
+	}{
+		{`echo hello > ` + file, "", "hello\n"},
+		{`echo again >> ` + file, "", "hello\nagain\n"},
+		{`upper < ` + file, "HELLO\nAGAIN\n", "hello\nagain\n"},
+		{`upper < ` + file + ` > ` + file + `.up`, "", "hello\nagain\n"},
+		{both + ` 2> ` + file, "out\n", "err\n"},
+		{both + ` &> ` + file, "", "out\nerr\n"},
+		{both + ` > ` + file + ` 2>&1`, "", "out\nerr\n"},
+		{both + ` 2>&1 > ` + file, "err\n", "out\n"},
+		{`> ` + file, "", ""},
+		// the errors of the commands follow their stderr
+		{`nosuchcmd 2> ` + file, "", "command not found: nosuchcmd\n"},
+		{`nosuchcmd 2>/dev/null; echo $? > ` + file, "", "127\n"},
+		{`cd /nope &> ` + file + ` || echo failed`, "failed\n", "chdir /nope: no such file or directory\n"},
+		{`{ cd /nope; } 2> ` + file, "", "chdir /nope: no such file or directory\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		shell.commands["cd"] = cdTestCmd("cd")
+		shell.handle(shell.ctx, test.line)
+		if out.String() != test.out {
+			t.Errorf("%s: got output %q, want %q", test.line, out.String(), test.out)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != test.file {
+			t.Errorf("%s: got file %q, want %q", test.line, content, test.file)
+		}
+	}
+
+	content, err := os.ReadFile(file + ".up")
+	if err != nil || string(content) != "HELLO\nAGAIN\n" {
+		t.Errorf("redirected plugin output: got %q, %v", content, err)
+	}
+}
+
+func TestShellRedirectRestoresStreams(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	ctx, err := shell.handle(shell.ctx, "upper > "+filepath.Join(t.TempDir(), "out.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Value("gosh.stdout") != shell.ctx.Value("gosh.stdout") {
+		t.Error("redirected stdout leaked into the returned context")
+	}
+	if _, err := shell.handle(shell.ctx, "upper < /no/such/file"); err == nil {
+		t.Error("expected an error redirecting from a missing file")
+	}
+}
+
+func TestShellHeredoc(t *testing.T) {
+	tests := []struct {
+		line string
+		out  string
+	}{
+		{"X=world\nupper <<EOF\nhello $X\n  $(echo sub)\nEOF\n", "HELLO WORLD\n  SUB\n"},
+		{"X=world\nupper <<'EOF'\nhello $X\nEOF\n", "HELLO $X\n"},
+		{"X=world\nupper <<\"EOF\"\n`echo no`\nEOF\n", "`ECHO NO`\n"},
+		{"upper <<-EOF\n\t\tindented\n\tEOF\n", "INDENTED\n"},
+		{"upper <<EOF\n\tkept\nEOF\n", "\tKEPT\n"},
+		{"cat <<EOF\nexternal\nEOF\n", "external\n"},
+		{"cat <<A; cat <<B\none\nA\ntwo\nB\n", "one\ntwo\n"},
+		{"cat <<EOF | upper\npiped\nEOF\n", "PIPED\n"},
+		{"cat <<EOF\nEOF\n", ""},
+		{"X=world\nupper <<< \"hello $X\"", "HELLO WORLD\n"},
+		{"cat <<< here", "here\n"},
+	}
+	for _, test := range tests {
+		out := new(syncBuffer)
+		shell := newTestShell(out)
+		if got := runLines(t, shell, out, test.line); got != test.out {
+			t.Errorf("%q: got %q, want %q", test.line, got, test.out)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// timeoutStatus is the status of a command that ran out of time
+const timeoutStatus = 124
+
+// parseTimeout reads a duration given as a number of seconds, which may be
+// fractional, with an optional s, m, h or d suffix
+func parseTimeout(spec string) (time.Duration, bool) {
+	unit := time.Second
+	switch {
+	case strings.HasSuffix(spec, "s"):
+		spec = strings.TrimSuffix(spec, "s")
+	case strings.HasSuffix(spec, "m"):
+		spec, unit = strings.TrimSuffix(spec, "m"), time.Minute
+	case strings.HasSuffix(spec, "h"):
+		spec, unit = strings.TrimSuffix(spec, "h"), time.Hour
+	case strings.HasSuffix(spec, "d"):
+		spec, unit = strings.TrimSuffix(spec, "d"), 24*time.Hour
+	}
+	n, err := strconv.ParseFloat(spec, 64)
+	if err != nil || n < 0 || math.IsInf(n, 0) || math.IsNaN(n) {
+		return 0, false
+	}
+	return time.Duration(n * float64(unit)), true
+}
+
+// timeoutCmd runs a command with a time limit, cancelling the context of a
+// plugin command and signaling a program once it is reached
+type timeoutCmd string
+
+func (c timeoutCmd) Name() string  { return string(c) }
+func (c timeoutCmd) Usage() string { return "timeout [-s signal] duration command [arg ...]" }
+func (c timeoutCmd) LongDesc() string {
+	return `  timeout 5 resolve example.com   gives up resolving after 5 seconds
+  timeout -s KILL 1m make         kills make after a minute, TERM is the default
+The duration is in seconds unless it ends in m, h or d, 0 sets no limit.
+The status is 124 when the command ran out of time.
+`
+}
+func (c timeoutCmd) ShortDesc() string {
+	return `runs a command, ending it once a duration has passed`
+}
+func (c timeoutCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	usage := statusError{status: 125, msg: fmt.Sprintf("%s: usage: %s", c.Name(), c.Usage())}
+
+	sig := syscall.SIGTERM
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	} else if len(args) > 1 && args[0] == "-s" {
+		s, ok := killSignal(args[1])
+		if !ok {
+			return ctx, statusError{status: 125, msg: fmt.Sprintf("%s: %s: invalid signal specification", c.Name(), args[1])}
+		}
+		sig, args = s, args[2:]
+	}
+	if len(args) < 2 {
+		return ctx, usage
+	}
+	limit, ok := parseTimeout(args[0])
+	if !ok {
+		return ctx, statusError{status: 125, msg: fmt.Sprintf("%s: %s: invalid time interval", c.Name(), args[0])}
+	}
+
+	runCtx := ctx
+	if limit > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, limit)
+		defer cancel()
+		runCtx = context.WithValue(runCtx, "gosh.timeout", sig)
+	}
+	// what the command leaves in its context can't outlive the limit
+	_, err = gosh.runCommand(runCtx, args[1:])
+	if errors.Is(runCtx.Err(), context.DeadlineExceeded) {
+		return ctx, api.ExitStatus(timeoutStatus)
+	}
+	return ctx, err
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stuckCmd is a test command that ignores the cancellation of its context
+// until release is closed
+type stuckCmd chan struct{}
+
+func (c stuckCmd) Name() string      { return "stuck" }
+func (c stuckCmd) Usage() string     { return c.Name() }
+func (c stuckCmd) ShortDesc() string { return `doesn't return when cancelled` }
+func (c stuckCmd) LongDesc() string  { return c.ShortDesc() }
+func (c stuckCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	<-c
+	return ctx, nil
+}
+
+func TestShellTimeout(t *testing.T) {
+	grace := cancelGrace
+	cancelGrace = 50 * time.Millisecond
+	defer func() { cancelGrace = grace }()
+	release := make(stuckCmd)
+	defer close(release)
+
+	tests := []scriptTest{
+		{"timeout 0.05 block; echo $?", "124\n", 0},
+		{"timeout 0.05s block || echo timed out", "timed out\n", 0},
+		{"timeout 5 echo done", "done\n", 0},
+		{"timeout 0 sh -c 'exit 3'", "", 3},
+		{"timeout 0.05 sleep 5", "", 124},
+		{"timeout -s KILL 0.05 sleep 5", "", 124},
+		{"timeout 0.05 stuck", "gosh: stuck: still running 50ms after being cancelled, abandoned\n", 124},
+		{"timeout soon block", "timeout: soon: invalid time interval\n", 125},
+		{"timeout -s NOPE 1 block", "timeout: NOPE: invalid signal specification\n", 125},
+		{"timeout 1", "timeout: usage: timeout [-s signal] duration command [arg ...]\n", 125},
+		// shell code stops, with no message, as the limit is reached
+		{"f() { while [ 1 ]; do x=1; done; }; timeout 0.1 f; echo $?", "124\n", 0},
+		{"g() { for i in 1 2 3; do block; done; echo never; }; f() { g; echo never; }; timeout 0.05 f", "", 124},
+		// the limit ends with the command
+		{"timeout 0.05 true; sleep 0.1; echo $?", "0\n", 0},
+	}
+	runScripts(t, tests, func(shell *Goshell) {
+		shell.commands["block"] = blockCmd("block")
+		shell.commands["stuck"] = release
+	})
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		spec  string
+		limit time.Duration
+		ok    bool
+	}{
+		{"2", 2 * time.Second, true},
+		{"1.5s", 1500 * time.Millisecond, true},
+		{"2m", 2 * time.Minute, true},
+		{"1h", time.Hour, true},
+		{".5d", 12 * time.Hour, true},
+		{"-1", 0, false},
+		{"1x", 0, false},
+		{"", 0, false},
+	}
+	for _, test := range tests {
+		if limit, ok := parseTimeout(test.spec); limit != test.limit || ok != test.ok {
+			t.Errorf("%q: got %v, %v, want %v, %v", test.spec, limit, ok, test.limit, test.ok)
+		}
+	}
+}
+
+func TestShellShutdown(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.commands["block"] = blockCmd("block")
+	if status := shell.Run(strings.NewReader("block &")); status != 0 {
+		t.Fatalf("got status %d starting the job", status)
+	}
+	// the job may not have started its command yet
+	time.Sleep(20 * time.Millisecond)
+	shell.shutdown()
+	jobs := shell.jobs.list()
+	if len(jobs) != 1 {
+		t.Fatalf("got %d jobs, want 1", len(jobs))
+	}
+	select {
+	case <-jobs[0].done:
+	case <-time.After(time.Second):
+		t.Fatal("the job's command was not cancelled when the shell exited")
+	}
+	if jobs[0].status == 0 {
+		t.Errorf("got status %d, want the job to fail", jobs[0].status)
+	}
+	// the job's command fails with the shell's exit as its cause, silently
+	if got := out.String(); got != "" {
+		t.Errorf("got %q, want no output from the cancelled job", got)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/donrudo/gosh/api"
+)
+
+// trapSignals are the signals that trap handles, in the order trap lists
+// them. EXIT and ERR are not signals: EXIT runs when the shell exits and
+// ERR when a command fails.
+var trapSignals = []struct {
+	name string
+	sig  syscall.Signal
+}{
+	{"EXIT", 0},
+	{"HUP", syscall.SIGHUP},
+	{"INT", syscall.SIGINT},
+	{"QUIT", syscall.SIGQUIT},
+	{"USR1", syscall.SIGUSR1},
+	{"USR2", syscall.SIGUSR2},
+	{"ALRM", syscall.SIGALRM},
+	{"TERM", syscall.SIGTERM},
+	{"ERR", -1},
+}
+
+// caughtSignals are always caught by the shell, as their default action
+// must run the EXIT trap before the shell ends
+var caughtSignals = []os.Signal{syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM}
+
+// signalName returns the name of a signal as trap knows it, from a name
+// with or without the SIG prefix or a number
+func signalName(spec string) (string, bool) {
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	n, err := strconv.Atoi(spec)
+	for _, ts := range trapSignals {
+		if ts.name == name || (err == nil && n >= 0 && int(ts.sig) == n) {
+			return ts.name, true
+		}
+	}
+	return "", false
+}
+
+// trapSignal returns the signal named name, or 0 for EXIT and ERR
+func trapSignal(name string) syscall.Signal {
+	for _, ts := range trapSignals {
+		if ts.name == name && ts.sig > 0 {
+			return ts.sig
+		}
+	}
+	return 0
+}
+
+// catchSignals starts delivering the signals trap handles to the session,
+// which runs their handlers between commands. INT and QUIT first interrupt
+// the commands running in the foreground.
+func (gosh *Goshell) catchSignals() {
+	gosh.sigs = make(chan os.Signal, 8)
+	gosh.notify = make(chan os.Signal, 8)
+	signal.Notify(gosh.notify, caughtSignals...)
+	if gosh.interactive {
+		signal.Notify(gosh.notify, syscall.SIGQUIT)
+	}
+	for name, cmd := range gosh.traps {
+		gosh.setTrap(name, cmd)
+	}
+	go func(notify <-chan os.Signal, sigs chan<- os.Signal) {
+		for sig := range notify {
+			if sig == syscall.SIGINT || sig == syscall.SIGQUIT {
+				gosh.fg.signal(sig.(syscall.Signal))
+			}
+			select {
+			case sigs <- sig:
+			default:
+			}
+		}
+	}(gosh.notify, gosh.sigs)
+}
+
+// catches reports whether the shell catches a signal without a trap
+func (gosh *Goshell) catches(sig syscall.Signal) bool {
+	for _, caught := range caughtSignals {
+		if caught == sig {
+			return true
+		}
+	}
+	return gosh.interactive && sig == syscall.SIGQUIT
+}
+
+// setTrap sets the handler of a signal, "" ignores it
+func (gosh *Goshell) setTrap(name, cmd string) {
+	gosh.traps[name] = cmd
+	sig := trapSignal(name)
+	switch {
+	case sig == 0 || gosh.notify == nil:
+	case cmd == "":
+		// ignored signals stay ignored in external commands
+		signal.Ignore(sig)
+	default:
+		signal.Notify(gosh.notify, sig)
+	}
+}
+
+// resetTrap gives back a signal its default action
+func (gosh *Goshell) resetTrap(name string) {
+	delete(gosh.traps, name)
+	sig := trapSignal(name)
+	switch {
+	case sig == 0 || gosh.notify == nil:
+	case gosh.catches(sig):
+		signal.Notify(gosh.notify, sig)
+	default:
+		signal.Reset(sig)
+	}
+}
+
+// checkSignals runs the handlers of the signals received since the last
+// check, an error is returned when one of them ends the session. The rest
+// of an interrupted command line, or of a killed job, doesn't run unless
+// the signal is trapped.
+func (gosh *Goshell) checkSignals(ctx context.Context) error {
+	if gosh.trapping {
+		return nil
+	}
+	for received := gosh.sigs != nil; received; {
+		select {
+		case sig := <-gosh.sigs:
+			if err := gosh.signaled(ctx, sig); err != nil {
+				return err
+			}
+		default:
+			received = false
+		}
+	}
+	if sig := gosh.fg.killedBy(); sig != 0 {
+		name, _ := signalName(strconv.Itoa(int(sig)))
+		if _, trapped := gosh.traps[name]; !trapped {
+			return interrupted{sig}
+		}
+	}
+	return nil
+}
+
+// signaled runs the handler of a signal or its default action, which ends
+// scripts. An interactive shell ignores INT, QUIT and TERM, INT having
+// interrupted the foreground command already.
+func (gosh *Goshell) signaled(ctx context.Context, sig os.Signal) error {
+	signum, _ := sig.(syscall.Signal)
+	name, _ := signalName(strconv.Itoa(int(signum)))
+	if cmd, ok := gosh.traps[name]; ok {
+		return gosh.runTrap(ctx, cmd)
+	}
+	if gosh.interactive && (signum == syscall.SIGINT || signum == syscall.SIGQUIT || signum == syscall.SIGTERM) {
+		return nil
+	}
+	return api.ExitShell(128 + int(signum))
+}
+
+// runTrap runs the handler of a trap, keeping $? as it was unless the
+// handler exits
+func (gosh *Goshell) runTrap(ctx context.Context, cmd string) error {
+	if cmd == "" {
+		return nil
+	}
+	status, trapping := gosh.status, gosh.trapping
+	gosh.trapping = true
+	// a command failing in a handler doesn't run the ERR trap again
+	gosh.condDepth++
+	defer func() { gosh.condDepth--; gosh.trapping = trapping }()
+
+	_, err := gosh.handle(ctx, cmd)
+	if isExit(err) {
+		return err
+	}
+	if err != nil && !unwinds(err) {
+		gosh.reportError(ctx, err)
+	}
+	gosh.status = status
+	return nil
+}
+
+// exitTrap runs the EXIT trap as the session ends with status, it returns
+// the status the shell exits with
+func (gosh *Goshell) exitTrap(ctx context.Context, status int) int {
+	cmd, ok := gosh.traps["EXIT"]
+	if !ok {
+		return status
+	}
+	delete(gosh.traps, "EXIT")
+	gosh.status = status
+	var exit api.ExitShell
+	if err := gosh.runTrap(ctx, cmd); errors.As(err, &exit) {
+		return int(exit)
+	}
+	return status
+}
+
+// trapCmd sets the commands run when the shell gets a signal or exits
+type trapCmd string
+
+func (c trapCmd) Name() string  { return string(c) }
+func (c trapCmd) Usage() string { return "trap [-lp] [[command|-] signal ...]" }
+func (c trapCmd) LongDesc() string {
+	return `  trap 'rm -f $TMP' EXIT   runs the command when the shell exits
+  trap 'echo failed' ERR   runs the command when a command fails
+  trap '' INT              ignores a signal, - resets it to its default
+  trap -p [signal ...]     prints the traps, trap -l the signal names
+`
+}
+func (c trapCmd) ShortDesc() string {
+	return `runs a command when the shell receives a signal (INT, TERM, HUP...), exits (EXIT) or a command fails (ERR)`
+}
+func (c trapCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	gosh, err := shellFrom(ctx)
+	if err != nil {
+		return ctx, err
+	}
+	out := api.GetStdout(ctx)
+
+	args = args[1:]
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	}
+	switch {
+	case len(args) > 0 && args[0] == "-l":
+		for _, ts := range trapSignals {
+			if ts.sig > 0 {
+				fmt.Fprintf(out, "%2d) SIG%s\n", ts.sig, ts.name)
+			}
+		}
+		return ctx, nil
+	case len(args) == 0 || args[0] == "-p":
+		names := make([]string, 0, len(trapSignals))
+		for _, ts := range trapSignals {
+			names = append(names, ts.name)
+		}
+		if len(args) > 1 {
+			names = names[:0]
+			for _, spec := range args[1:] {
+				name, ok := signalName(spec)
+				if !ok {
+					return ctx, statusError{status: 1, msg: fmt.Sprintf("%s: %s: invalid signal specification", c.Name(), spec)}
+				}
+				names = append(names, name)
+			}
+		}
+		for _, name := range names {
+			if cmd, ok := gosh.traps[name]; ok {
+				fmt.Fprintf(out, "trap -- %s %s\n", shellQuote(cmd), name)
+			}
+		}
+		return ctx, nil
+	}
+
+	// a lone signal, or - as the command, resets the signals
+	cmd, specs := args[0], args[1:]
+	reset := cmd == "-"
+	if _, ok := signalName(cmd); ok && len(args) == 1 {
+		reset, specs = true, args
+	}
+	if len(specs) == 0 {
+		return ctx, statusError{status: 2, msg: fmt.Sprintf("%s: signal expected\nusage: %s", c.Name(), c.Usage())}
+	}
+	var result error
+	for _, spec := range specs {
+		name, ok := signalName(spec)
+		switch {
+		case !ok:
+			result = statusError{status: 1, msg: fmt.Sprintf("%s: %s: invalid signal specification", c.Name(), spec)}
+		case reset:
+			gosh.resetTrap(name)
+		default:
+			gosh.setTrap(name, cmd)
+		}
+	}
+	return ctx, result
+}
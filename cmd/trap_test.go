@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShellTrap(t *testing.T) {
+	tests := []scriptTest{
+		{"trap 'args bye $?' EXIT; args one; false", "[one]\n[bye][1]\n", 1},
+		{"trap 'args bye $?' EXIT; set -e; sh -c 'exit 4'; args never", "[bye][4]\n", 4},
+		{"trap 'args err $?' ERR; false; args after $?; false || true; if false; then true; fi", "[err][1]\n[after][1]\n", 0},
+		{"trap 'args err' ERR; set -e; false; args never", "[err]\n", 1},
+		{"trap 'false' ERR; false; args $?", "[1]\n", 0},
+		{"trap 'args t' INT SIGTERM; trap 'rm -f x' 0; trap -p", "trap -- 'rm -f x' EXIT\ntrap -- 'args t' INT\ntrap -- 'args t' TERM\n", 0},
+		{"trap 'args t' INT TERM; trap - INT; trap TERM; trap -p INT TERM; trap -p", "", 0},
+		{"trap '' HUP; trap -p hup", "trap -- '' HUP\n", 0},
+		{"trap 'args x' FOO INT; args $?; trap -p", "trap: FOO: invalid signal specification\n[1]\ntrap -- 'args x' INT\n", 0},
+		{"trap 'args x'", "trap: signal expected\nusage: trap [-lp] [[command|-] signal ...]\n", 2},
+		{"f() { trap 'args bye' EXIT; }; f; args ran", "[ran]\n[bye]\n", 0},
+	}
+	runScripts(t, tests, nil)
+
+	// signals are handled after the command that was running
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.catchSignals()
+	defer shell.resetTrap("USR1")
+	if status := shell.Run(strings.NewReader("trap 'args got $?' USR1; false; args next")); status != 0 {
+		t.Fatalf("trap: got status %d", status)
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	// the signal is delivered asynchronously, wait for it to be queued
+	for i := 0; len(shell.sigs) == 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	status := shell.Run(strings.NewReader("false; args next $?"))
+	if got, want := out.String(), "[next]\n[got][1]\n[next][1]\n"; got != want || status != 0 {
+		t.Errorf("got %q with status %d, want %q with status 0", got, status, want)
+	}
+}
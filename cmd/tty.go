@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether f is a terminal, asking for its foreground
+// process group fails with ENOTTY otherwise
+func isTerminal(f *os.File) bool {
+	_, err := foregroundGroup(f)
+	return err == nil
+}
+
+// foregroundGroup returns the process group the terminal f belongs to
+func foregroundGroup(f *os.File) (int, error) {
+	var pgid int32
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCGPGRP), uintptr(unsafe.Pointer(&pgid)))
+	if errno != 0 {
+		return 0, errno
+	}
+	return int(pgid), nil
+}
+
+// setForegroundGroup gives the terminal f to a process group
+func setForegroundGroup(f *os.File, pgid int) error {
+	p := int32(pgid)
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TIOCSPGRP), uintptr(unsafe.Pointer(&p)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// startJobControl puts the shell in its own process group holding the
+// terminal tty, so that external commands can be given the terminal and
+// take Ctrl+C in their own process groups
+func (gosh *Goshell) startJobControl(tty *os.File) {
+	// the shell takes the terminal back from the background, which would
+	// stop it with SIGTTOU
+	signal.Ignore(syscall.SIGTTOU)
+	// Ctrl+Z stops the foreground job, not the shell. The signal is caught
+	// rather than ignored, external commands get its default action back.
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGTSTP)
+	// a session leader already leads its process group
+	_ = syscall.Setpgid(0, 0)
+	if err := setForegroundGroup(tty, syscall.Getpgrp()); err != nil {
+		fmt.Fprintf(os.Stderr, "gosh: no job control: %v\n", err)
+		return
+	}
+	gosh.tty = tty
+}
+
+// foreground keeps track of the commands the session waits for, which
+// Ctrl+C interrupts: the contexts of running plugin commands and the
+// process groups of external ones. A background job has its own.
+type foreground struct {
+	mu      sync.Mutex
+	next    int
+	cancels map[int]context.CancelCauseFunc
+	groups  map[int]bool
+	// terminal is set when the process groups are given the terminal,
+	// killed is the signal that ended the commands, the ones left of the
+	// command line don't run
+	terminal bool
+	killed   syscall.Signal
+	// ended cancels the plugin commands started once the shell exits, idle
+	// is closed when the last running one returns
+	ended error
+	idle  chan struct{}
+}
+
+func newForeground(terminal bool) *foreground {
+	return &foreground{
+		cancels:  make(map[int]context.CancelCauseFunc),
+		groups:   make(map[int]bool),
+		terminal: terminal,
+	}
+}
+
+// interrupted is the cause of the cancellation of a plugin command's
+// context by a signal, and the error ending the commands left
+type interrupted struct {
+	sig syscall.Signal
+}
+
+func (e interrupted) Error() string { return "interrupted by " + e.sig.String() }
+func (e interrupted) ExitCode() int { return 128 + int(e.sig) }
+
+// cancelled is the error unwinding the shell code running with a context
+// cancelled otherwise than by a signal: by timeout or the shell exiting
+type cancelled struct {
+	cause error
+}
+
+func (e cancelled) Error() string { return e.cause.Error() }
+func (e cancelled) Unwrap() error { return e.cause }
+func (e cancelled) ExitCode() int {
+	if errors.Is(e.cause, context.DeadlineExceeded) {
+		return timeoutStatus
+	}
+	return 1
+}
+
+// cancelCause returns the error unwinding shell code once ctx is
+// cancelled, nil while it isn't
+func cancelCause(ctx context.Context) error {
+	cause := context.Cause(ctx)
+	var intr interrupted
+	switch {
+	case cause == nil:
+		return nil
+	case errors.As(cause, &intr):
+		return intr
+	}
+	return cancelled{cause}
+}
+
+// terminates reports whether sig ends the commands it is sent to, rather
+// than stopping or continuing them or being ignored by default
+func terminates(sig syscall.Signal) bool {
+	switch sig {
+	case syscall.SIGCONT, syscall.SIGSTOP, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU,
+		syscall.SIGCHLD, syscall.SIGWINCH, syscall.SIGURG:
+		return false
+	}
+	return true
+}
+
+// command returns the context a plugin command runs with, which signal
+// cancels, and the function to call once it has returned
+func (fg *foreground) command(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	fg.mu.Lock()
+	fg.next++
+	id := fg.next
+	if len(fg.cancels) == 0 {
+		fg.idle = make(chan struct{})
+	}
+	fg.cancels[id] = cancel
+	if fg.killed != 0 {
+		cancel(interrupted{fg.killed})
+	}
+	if fg.ended != nil {
+		cancel(fg.ended)
+	}
+	fg.mu.Unlock()
+	return ctx, func() {
+		fg.mu.Lock()
+		delete(fg.cancels, id)
+		if len(fg.cancels) == 0 {
+			close(fg.idle)
+		}
+		fg.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// end cancels the running plugin commands and the ones started later with
+// cause, leaving the process groups alone. The returned channel is closed
+// once none runs.
+func (fg *foreground) end(cause error) <-chan struct{} {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.ended = cause
+	for _, cancel := range fg.cancels {
+		cancel(cause)
+	}
+	if len(fg.cancels) == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	return fg.idle
+}
+
+// holdsTerminal reports whether the process groups are given the terminal
+func (fg *foreground) holdsTerminal() bool {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	return fg.terminal
+}
+
+// addGroup records the process group of an external command
+func (fg *foreground) addGroup(pgid int) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.groups[pgid] = true
+	if fg.killed != 0 {
+		_ = syscall.Kill(-pgid, fg.killed)
+	}
+}
+
+// removeGroup forgets an ended process group, it reports whether the
+// shell takes the terminal back
+func (fg *foreground) removeGroup(pgid int) bool {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	delete(fg.groups, pgid)
+	return fg.terminal
+}
+
+// signal sends sig on to the process groups, a signal ending them also
+// cancels the running plugin commands and the ones left to run
+func (fg *foreground) signal(sig syscall.Signal) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	for pgid := range fg.groups {
+		_ = syscall.Kill(-pgid, sig)
+	}
+	if !terminates(sig) {
+		return
+	}
+	fg.killed = sig
+	for _, cancel := range fg.cancels {
+		cancel(interrupted{sig})
+	}
+}
+
+// killedBy returns the signal that ended the commands, 0 if none did
+func (fg *foreground) killedBy() syscall.Signal {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	return fg.killed
+}
+
+// reset readies the foreground for a new command line
+func (fg *foreground) reset() {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.killed = 0
+}
+
+// procGroup is the process group of the external commands of a pipeline,
+// the first one started leads it. text is the source of the pipeline.
+type procGroup struct {
+	mu   sync.Mutex
+	pgid int
+	text string
+}
+
+// id returns the id of the group, 0 before its first command started
+func (pg *procGroup) id() int {
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+	return pg.pgid
+}
+
+// startProcess starts an external command. With job control, or in a
+// background job, it joins the process group of the pipeline or job in
+// ctx, or a group of its own. A group in the foreground is given the
+// terminal. It returns the group of the command, nil without one, and the
+// function giving the terminal back to the shell when the command leads
+// its own group.
+func (gosh *Goshell) startProcess(ctx context.Context, cmd *exec.Cmd) (*procGroup, func(), error) {
+	pg, ok := ctx.Value("gosh.pgroup").(*procGroup)
+	if gosh.tty == nil && !ok {
+		return nil, func() {}, cmd.Start()
+	}
+	if !ok {
+		text, _ := ctx.Value("gosh.jobtext").(string)
+		pg = &procGroup{text: text}
+	}
+	pg.mu.Lock()
+	defer pg.mu.Unlock()
+
+	// the group ends with its last process, a later command of the
+	// pipeline then starts a new one. The processes are reaped as they
+	// end, the group may be gone by the time the command joins it.
+	if pg.pgid != 0 && syscall.Kill(-pg.pgid, 0) == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Pgid: pg.pgid}
+		err := cmd.Start()
+		if err == nil {
+			if gosh.fg.holdsTerminal() && gosh.tty != nil {
+				_ = setForegroundGroup(gosh.tty, pg.pgid)
+			}
+			return pg, func() {}, nil
+		}
+		if !errors.Is(err, syscall.EPERM) {
+			return nil, func() {}, err
+		}
+		// a command is started once, a new one leads a new group
+		*cmd = exec.Cmd{
+			Path:       cmd.Path,
+			Args:       cmd.Args,
+			Env:        cmd.Env,
+			Dir:        cmd.Dir,
+			Stdin:      cmd.Stdin,
+			Stdout:     cmd.Stdout,
+			Stderr:     cmd.Stderr,
+			ExtraFiles: cmd.ExtraFiles,
+		}
+	}
+	if pg.pgid != 0 {
+		gosh.forgetGroup(pg.pgid)
+	}
+	// the leader of a group in the foreground takes the terminal before it
+	// runs, a program reading it at once would be stopped by SIGTTIN
+	// otherwise
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if gosh.fg.holdsTerminal() && gosh.tty != nil {
+		cmd.SysProcAttr.Foreground = true
+		cmd.SysProcAttr.Ctty = int(gosh.tty.Fd())
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, func() {}, err
+	}
+	pg.pgid = cmd.Process.Pid
+	gosh.fg.addGroup(pg.pgid)
+	if ok {
+		return pg, func() {}, nil
+	}
+	return pg, func() {
+		gosh.reportStopped(ctx, pg)
+		gosh.releaseGroup(pg)
+	}, nil
+}
+
+// releaseGroup forgets the process group of a pipeline once it has ended,
+// taking the terminal back when it was in the foreground
+func (gosh *Goshell) releaseGroup(pg *procGroup) {
+	gosh.forgetGroup(pg.id())
+}
+
+// forgetGroup is releaseGroup for the group pgid, its procGroup locked
+func (gosh *Goshell) forgetGroup(pgid int) {
+	if pgid == 0 {
+		return
+	}
+	if gosh.fg.removeGroup(pgid) && gosh.tty != nil {
+		_ = setForegroundGroup(gosh.tty, syscall.Getpgrp())
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockCmd is a test command that runs until its context is cancelled
+type blockCmd string
+
+func (c blockCmd) Name() string      { return string(c) }
+func (c blockCmd) Usage() string     { return c.Name() }
+func (c blockCmd) ShortDesc() string { return `waits to be interrupted` }
+func (c blockCmd) LongDesc() string  { return c.ShortDesc() }
+func (c blockCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
+	<-ctx.Done()
+	return context.WithValue(ctx, "gosh.prompt", "waited>"), ctx.Err()
+}
+
+func TestShellInterrupt(t *testing.T) {
+	out := new(syncBuffer)
+	shell := newTestShell(out)
+	shell.commands["block"] = blockCmd("block")
+
+	type result struct {
+		ctx context.Context
+		err error
+	}
+	done := make(chan result)
+	go func() {
+		ctx, err := shell.handle(shell.ctx, "upper | block; args after $?")
+		done <- result{ctx, err}
+	}()
+	// interrupt until the command has started
+	var res result
+	for res.ctx == nil {
+		shell.fg.signal(syscall.SIGINT)
+		select {
+		case res = <-done:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	// the rest of the command line doesn't run
+	if got := out.String(); got != "" || !errors.As(res.err, new(interrupted)) || shell.status != 130 {
+		t.Errorf("got %q, error %v with status %d, want nothing run after the interrupt and status 130", got, res.err, shell.status)
+	}
+
+	// the context a command returns is not cancelled with it
+	out = new(syncBuffer)
+	shell = newTestShell(out)
+	shell.commands["block"] = blockCmd("block")
+	go func() {
+		ctx, err := shell.handle(shell.ctx, "block")
+		done <- result{ctx, err}
+	}()
+	res = result{}
+	for res.ctx == nil {
+		shell.fg.signal(syscall.SIGINT)
+		select {
+		case res = <-done:
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if shell.status != 130 || res.ctx.Err() != nil || res.ctx.Value("gosh.prompt") != "waited>" {
+		t.Errorf("got status %d and context error %v, want 130 and no error", shell.status, res.ctx.Err())
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// variable is a shell variable, exported variables are passed in the
+// environment of external commands. An array keeps its elements in elems,
+// indexed by their decimal index or, for an associative array, by key.
+type variable struct {
+	value    string
+	exported bool
+	elems    map[string]string
+	assoc    bool
+}
+
+// clone returns a copy of v sharing nothing with it
+func (v *variable) clone() *variable {
+	c := *v
+	if v.elems != nil {
+		c.elems = make(map[string]string, len(v.elems))
+		for key, value := range v.elems {
+			c.elems[key] = value
+		}
+	}
+	return &c
+}
+
+// keys returns the keys of an array's elements, in index order for an
+// indexed array and sorted for an associative one
+func (v *variable) keys() []string {
+	keys := make([]string, 0, len(v.elems))
+	for key := range v.elems {
+		keys = append(keys, key)
+	}
+	if v.assoc {
+		sort.Strings(keys)
+		return keys
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		x, _ := strconv.Atoi(a)
+		y, _ := strconv.Atoi(b)
+		return x - y
+	})
+	return keys
+}
+
+// loadEnviron creates an exported variable for each environment variable
+// of the gosh process
+func loadEnviron() map[string]*variable {
+	vars := make(map[string]*variable)
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !isName(name) {
+			continue
+		}
+		vars[name] = &variable{value: value, exported: true}
+	}
+	return vars
+}
+
+// getVar returns the value of a variable and whether it is set, the value
+// of an array is its element 0
+func (gosh *Goshell) getVar(name string) (string, bool) {
+	v, ok := gosh.vars[name]
+	if !ok {
+		return "", false
+	}
+	if v.elems != nil {
+		value, ok := v.elems["0"]
+		return value, ok
+	}
+	return v.value, true
+}
+
+// setVar sets the value of a variable, keeping its export attribute
+func (gosh *Goshell) setVar(name, value string) {
+	if v, ok := gosh.vars[name]; ok {
+		if v.elems != nil {
+			v.elems["0"] = value
+			return
+		}
+		v.value = value
+		return
+	}
+	gosh.vars[name] = &variable{value: value}
+}
+
+// getElem returns the element of an array and whether it is set, a
+// variable that isn't an array only has an element 0
+func (gosh *Goshell) getElem(name, key string) (string, bool) {
+	v, ok := gosh.vars[name]
+	switch {
+	case !ok:
+		return "", false
+	case v.elems != nil:
+		value, ok := v.elems[key]
+		return value, ok
+	case key == "0":
+		return v.value, true
+	}
+	return "", false
+}
+
+// setElem sets the element of an array, a variable that isn't an array
+// becomes one with its value as element 0
+func (gosh *Goshell) setElem(name, key, value string) {
+	v, ok := gosh.vars[name]
+	if !ok {
+		v = &variable{}
+		gosh.vars[name] = v
+	}
+	if v.elems == nil {
+		v.elems = make(map[string]string)
+		if ok {
+			v.elems["0"] = v.value
+		}
+		v.value = ""
+	}
+	v.elems[key] = value
+}
+
+// arrayValues returns the elements of an array, or their keys, in order
+func (gosh *Goshell) arrayValues(name string, keys bool) []string {
+	v, ok := gosh.vars[name]
+	switch {
+	case !ok:
+		return nil
+	case v.elems == nil && keys:
+		return []string{"0"}
+	case v.elems == nil:
+		return []string{v.value}
+	}
+	list := v.keys()
+	if !keys {
+		for i, key := range list {
+			list[i] = v.elems[key]
+		}
+	}
+	return list
+}
+
+// isAssoc reports whether a variable is an associative array
+func (gosh *Goshell) isAssoc(name string) bool {
+	v, ok := gosh.vars[name]
+	return ok && v.assoc
+}
+
+// exportVar marks a variable as exported, creating it empty if needed
+func (gosh *Goshell) exportVar(name string, exported bool) {
+	v, ok := gosh.vars[name]
+	if !ok {
+		v = &variable{}
+		gosh.vars[name] = v
+	}
+	v.exported = exported
+}
+
+func (gosh *Goshell) unsetVar(name string) {
+	delete(gosh.vars, name)
+}
+
+// unsetElem removes an element of an array
+func (gosh *Goshell) unsetElem(name, key string) {
+	v, ok := gosh.vars[name]
+	switch {
+	case !ok:
+	case v.elems != nil:
+		delete(v.elems, key)
+	case key == "0":
+		delete(gosh.vars, name)
+	}
+}
+
+// updatePwd keeps $PWD and $OLDPWD in step with the working directory,
+// which plugin commands such as cd change directly
+func (gosh *Goshell) updatePwd() {
+	wd, err := os.Getwd()
+	if err != nil {
+		return
+	}
+	if pwd, ok := gosh.getVar("PWD"); !ok || pwd != wd {
+		if ok {
+			gosh.setVar("OLDPWD", pwd)
+		}
+		gosh.setVar("PWD", wd)
+	}
+}
+
+// ifs returns the field separators used to split unquoted expansions
+func (gosh *Goshell) ifs() string {
+	if ifs, ok := gosh.getVar("IFS"); ok {
+		return ifs
+	}
+	return " \t\n"
+}
+
+// environ returns the exported variables as a sorted NAME=value list for
+// the environment of external commands
+func (gosh *Goshell) environ() []string {
+	env := make([]string, 0, len(gosh.vars))
+	for name, v := range gosh.vars {
+		// arrays can't be passed in the environment
+		if v.exported && v.elems == nil {
+			env = append(env, name+"="+v.value)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+// withAssigns applies the assignments of a command for its duration, they
+// are exported so external commands see them too. The returned function
+// restores the previous variables.
+func (gosh *Goshell) withAssigns(assigns map[string]string) func() {
+	saved := make(map[string]*variable, len(assigns))
+	for name, value := range assigns {
+		saved[name] = gosh.vars[name]
+		gosh.vars[name] = &variable{value: value, exported: true}
+	}
+	return func() {
+		for name, v := range saved {
+			if v == nil {
+				delete(gosh.vars, name)
+				continue
+			}
+			gosh.vars[name] = v
+		}
+	}
+}
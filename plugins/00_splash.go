@@ -14,7 +14,7 @@ type splashCmds struct{}
 
 func (t *splashCmds) Init(ctx context.Context) error {
 	// to set your splash, modify the text in the println statement below, multiline is supported
-	fmt.Println(`		
+	fmt.Fprintln(api.GetStdout(ctx), `		
                         888      	
                         888      	
                         888      	
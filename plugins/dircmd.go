@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -19,7 +20,7 @@ func (t pwdCmd) Usage() string     { return `pwd` }
 func (t pwdCmd) ShortDesc() string { return `finds working directory"` }
 func (t pwdCmd) LongDesc() string  { return t.ShortDesc() }
 func (t pwdCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	customPWD()
+	customPWD(api.GetStdout(ctx))
 	return ctx, nil
 }
 
@@ -39,8 +40,9 @@ func (t dirCmd) Exec(ctx context.Context, args []string) (context.Context, error
 	if err != nil {
 		log.Println(err)
 	}
+	out := api.GetStdout(ctx)
 	for _, f := range files {
-		fmt.Println(f.Name())
+		fmt.Fprintln(out, f.Name())
 	}
 	return ctx, nil
 }
@@ -53,7 +55,10 @@ func (t cdCmd) ShortDesc() string { return `change dir` }
 func (t cdCmd) LongDesc() string  { return t.ShortDesc() }
 func (t cdCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
 	cmdArgs := strings.Join(args[1:], " ")
-	os.Chdir(cmdArgs)
+	// a failed cd fails the command, so that cd dir && make doesn't make
+	if err := os.Chdir(cmdArgs); err != nil {
+		return ctx, fmt.Errorf("%s: %s: %v", t.Name(), cmdArgs, errors.Unwrap(err))
+	}
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Println(err)
@@ -81,11 +86,11 @@ func (t *dirCmds) Registry() map[string]api.Command {
 // Commands just dir
 var Commands dirCmds
 
-func customPWD() {
+func customPWD(out io.Writer) {
 	var mydir string
 	mydir, err := os.Getwd()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(out, err)
 	}
-	fmt.Println(mydir)
+	fmt.Fprintln(out, mydir)
 }
@@ -1,12 +1,16 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"github.com/donrudo/gosh/api"
 	"io"
 	"net"
+	"os"
 	"strings"
+	"syscall"
+	"unsafe"
 )
 
 type resolveCmd string
@@ -22,23 +26,28 @@ func (t resolveCmd) LongDesc() string  { return t.ShortDesc() }
 func (t resolveCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
 	out := ctx.Value("gosh.stdout").(io.Writer)
 
-	if len(args) != 2 {
+	if len(args) == 2 {
+		return ctx, resolve(ctx, out, args[1])
+	}
 
+	// without a HOST, resolve every hostname piped or redirected in
+	in := api.GetStdin(ctx)
+	if len(args) != 1 || isTerminal(in) {
 		fmt.Fprintln(out, t.Usage())
 		return ctx, nil
 	}
 
-	addressList, err := net.LookupHost(args[1])
-	if err != nil {
-		return ctx, err
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		host := strings.TrimSpace(scanner.Text())
+		if host == "" {
+			continue
+		}
+		if err := resolve(ctx, out, host); err != nil {
+			return ctx, err
+		}
 	}
-
-	fmt.Fprintln(out, strings.Join(addressList, "\n"))
-
-	if err != nil {
-		return ctx, err
-	}
-	return ctx, nil
+	return ctx, scanner.Err()
 }
 
 type networkCmds struct{}
@@ -66,3 +75,24 @@ var Commands networkCmds
 // If your plugin needs extra functions, declare
 // them down here to call upon, or import their
 // library.
+
+// isTerminal reports whether in is a terminal, nothing is piped in then
+func isTerminal(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	if !ok {
+		return false
+	}
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), uintptr(syscall.TCGETS), uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
+
+// resolve gives up when ctx is cancelled, by Ctrl+C or timeout
+func resolve(ctx context.Context, out io.Writer, host string) error {
+	addressList, err := net.DefaultResolver.LookupHost(ctx, host)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(out, strings.Join(addressList, "\n"))
+	return nil
+}
@@ -25,8 +25,13 @@ func (s sleepCmd) Exec(ctx context.Context, args []string) (context.Context, err
 		if err != nil {
 			return ctx, err
 		}
-		time.Sleep(time.Duration(duration) * time.Second)
-		return ctx, nil
+		// Ctrl+C or timeout cut the sleep short
+		select {
+		case <-time.After(time.Duration(duration) * time.Second):
+			return ctx, nil
+		case <-ctx.Done():
+			return ctx, context.Cause(ctx)
+		}
 	}
 	out := ctx.Value("gosh.stdout").(io.Writer)
 	fmt.Fprintln(out, s.Usage())
@@ -75,22 +75,6 @@ func (h helpCmd) Exec(ctx context.Context, args []string) (context.Context, erro
 	return ctx, nil
 }
 
-// exitCmd implements a command to exit the shell
-type exitCmd string
-
-func (c exitCmd) Name() string     { return string(c) }
-func (c exitCmd) Usage() string    { return "exit" }
-func (c exitCmd) LongDesc() string { return "" }
-func (c exitCmd) ShortDesc() string {
-	return `exits the interactive shell immediately`
-}
-func (c exitCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
-	out := api.GetStdout(ctx)
-	fmt.Fprintln(out, "exiting...")
-	os.Exit(0)
-	return ctx, nil
-}
-
 // promptCmd a command that can change the prompt value
 type promptCmd string
 
@@ -158,7 +142,6 @@ func (c *sysCommands) Init(ctx context.Context) error {
 func (t *sysCommands) Registry() map[string]api.Command {
 	return map[string]api.Command{
 		"help":   helpCmd("help"),
-		"exit":   exitCmd("exit"),
 		"prompt": promptCmd("prompt"),
 		"sys":    sysinfoCmd("sys"),
 	}
@@ -35,7 +35,7 @@ func (t echoCmd) LongDesc() string  { return t.ShortDesc() }
 func (t echoCmd) Exec(ctx context.Context, args []string) (context.Context, error) {
 
 	cmdArgs := strings.Join(args[1:], " ")
-	fmt.Println(cmdArgs)
+	fmt.Fprintln(api.GetStdout(ctx), cmdArgs)
 	return ctx, nil
 }
 